@@ -0,0 +1,174 @@
+package zai
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// ChatCompletionAccumulator rebuilds a ChatCompletion from the chunks of a
+// streaming response. Content and reasoning deltas are concatenated, tool call
+// argument fragments are merged by index, and the finish reason and usage
+// reported by the stream are recorded.
+type ChatCompletionAccumulator struct {
+	id      string
+	created int64
+	model   string
+	usage   CompletionUsage
+	choices []*accumulatedChoice // Ordered by index
+}
+
+// accumulatedChoice collects the deltas of a single choice
+type accumulatedChoice struct {
+	index        int
+	role         string
+	finishReason string
+	content      strings.Builder
+	hasContent   bool
+	reasoning    strings.Builder
+	hasReasoning bool
+	toolCalls    []ToolCall
+	toolIndexes  map[int]int // Stream tool call index -> position in toolCalls
+}
+
+// Add merges a chunk into the accumulated completion
+func (a *ChatCompletionAccumulator) Add(chunk *ChatCompletionChunk) {
+	if chunk.ID != "" {
+		a.id = chunk.ID
+	}
+	if chunk.Created != 0 {
+		a.created = chunk.Created
+	}
+	if chunk.Model != "" {
+		a.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		a.usage = *chunk.Usage
+	}
+
+	for _, c := range chunk.Choices {
+		choice := a.choice(c.Index)
+		delta := c.Delta
+
+		if delta.Role != nil && *delta.Role != "" {
+			choice.role = *delta.Role
+		}
+		if delta.Content != nil {
+			choice.content.WriteString(*delta.Content)
+			choice.hasContent = true
+		}
+		if delta.ReasoningContent != nil {
+			choice.reasoning.WriteString(*delta.ReasoningContent)
+			choice.hasReasoning = true
+		}
+		for _, call := range delta.ToolCalls {
+			choice.addToolCall(call)
+		}
+		if c.FinishReason != nil && *c.FinishReason != "" {
+			choice.finishReason = *c.FinishReason
+		}
+	}
+}
+
+// Completion returns the completion accumulated so far, with the choices
+// ordered by index. Later calls to Add do not change the returned completion.
+func (a *ChatCompletionAccumulator) Completion() *ChatCompletion {
+	completion := &ChatCompletion{
+		ID:      a.id,
+		Created: a.created,
+		Model:   a.model,
+		Choices: make([]CompletionChoice, 0, len(a.choices)),
+		Usage:   a.usage,
+	}
+
+	for _, choice := range a.choices {
+		message := CompletionMessage{
+			Role:      choice.role,
+			ToolCalls: append([]ToolCall(nil), choice.toolCalls...),
+		}
+		if message.Role == "" {
+			message.Role = "assistant"
+		}
+		if choice.hasContent {
+			content := choice.content.String()
+			message.Content = &content
+		}
+		if choice.hasReasoning {
+			reasoning := choice.reasoning.String()
+			message.ReasoningContent = &reasoning
+		}
+
+		completion.Choices = append(completion.Choices, CompletionChoice{
+			Index:        choice.index,
+			FinishReason: choice.finishReason,
+			Message:      message,
+		})
+	}
+
+	return completion
+}
+
+// choice returns the accumulated choice with the given index, creating it if needed
+func (a *ChatCompletionAccumulator) choice(index int) *accumulatedChoice {
+	i := sort.Search(len(a.choices), func(i int) bool { return a.choices[i].index >= index })
+	if i < len(a.choices) && a.choices[i].index == index {
+		return a.choices[i]
+	}
+
+	choice := &accumulatedChoice{index: index, toolIndexes: map[int]int{}}
+	a.choices = append(a.choices, nil)
+	copy(a.choices[i+1:], a.choices[i:])
+	a.choices[i] = choice
+	return choice
+}
+
+// addToolCall merges a tool call fragment. Fragments sharing an index belong
+// to the same call; fragments without an index start a new call when they
+// carry a new ID and otherwise continue the previous one.
+func (c *accumulatedChoice) addToolCall(call ToolCall) {
+	pos := -1
+	if call.Index != nil {
+		if p, ok := c.toolIndexes[*call.Index]; ok {
+			pos = p
+		}
+	} else if n := len(c.toolCalls); n > 0 && (call.ID == "" || call.ID == c.toolCalls[n-1].ID) {
+		pos = n - 1
+	}
+
+	if pos < 0 {
+		if call.Index != nil {
+			c.toolIndexes[*call.Index] = len(c.toolCalls)
+		}
+		call.Index = nil
+		c.toolCalls = append(c.toolCalls, call)
+		return
+	}
+
+	existing := &c.toolCalls[pos]
+	if call.ID != "" {
+		existing.ID = call.ID
+	}
+	if call.Type != "" {
+		existing.Type = call.Type
+	}
+	if call.Function.Name != "" {
+		existing.Function.Name = call.Function.Name
+	}
+	existing.Function.Arguments += call.Function.Arguments
+}
+
+// Accumulate reads the remaining chunks from the stream and returns the
+// complete ChatCompletion. The stream is not closed.
+func (s *ChatCompletionStream) Accumulate() (*ChatCompletion, error) {
+	var acc ChatCompletionAccumulator
+	for {
+		chunk, err := s.Next()
+		if err == io.EOF {
+			return acc.Completion(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		acc.Add(chunk)
+	}
+}
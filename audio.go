@@ -0,0 +1,214 @@
+package zai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// AudioService handles audio operations
+type AudioService struct {
+	client *BaseClient
+}
+
+// AudioTranscriptionRequest represents a speech-to-text request.
+// Either File or FilePath must be set; File takes precedence.
+type AudioTranscriptionRequest struct {
+	File        io.Reader // Audio content
+	FilePath    string    // Path of an audio file to read when File is nil
+	Filename    string    // Defaults to the base name of FilePath
+	Model       string
+	Language    *string
+	Prompt      *string
+	Temperature *float64
+	RequestID   *string
+	UserID      *string
+}
+
+// TranscriptionSegment represents a timed segment of a transcription
+type TranscriptionSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// AudioTranscription represents a speech-to-text response
+type AudioTranscription struct {
+	ID        string                 `json:"id"`
+	Created   int64                  `json:"created"`
+	RequestID string                 `json:"request_id"`
+	Model     string                 `json:"model"`
+	Text      string                 `json:"text"`
+	Segments  []TranscriptionSegment `json:"segments,omitempty"`
+}
+
+// AudioTranscriptionChunk represents an incremental streaming transcription event
+type AudioTranscriptionChunk struct {
+	ID        string `json:"id"`
+	Created   int64  `json:"created"`
+	RequestID string `json:"request_id,omitempty"`
+	Model     string `json:"model"`
+	Type      string `json:"type"`           // "transcript.text.delta" or "transcript.text.done"
+	Delta     string `json:"delta"`          // Text appended since the previous chunk
+	Text      string `json:"text,omitempty"` // Full transcript, set on the final chunk
+}
+
+// AudioTranscriptionStream represents a streaming transcription response
+type AudioTranscriptionStream struct {
+	stream *streamReader
+}
+
+// Next reads the next chunk from the stream
+func (s *AudioTranscriptionStream) Next() (*AudioTranscriptionChunk, error) {
+	data, err := s.stream.next()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunk AudioTranscriptionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		err = fmt.Errorf("failed to unmarshal chunk: %w", err)
+		s.stream.state.finish(nil, err)
+		return nil, err
+	}
+
+	return &chunk, nil
+}
+
+// Close closes the stream
+func (s *AudioTranscriptionStream) Close() error {
+	return s.stream.close()
+}
+
+// AudioSpeechRequest represents a text-to-speech request
+type AudioSpeechRequest struct {
+	Model            string   `json:"model"`
+	Input            string   `json:"input"`
+	Voice            *string  `json:"voice,omitempty"`
+	ResponseFormat   *string  `json:"response_format,omitempty"` // "wav", "mp3" or "pcm"
+	Speed            *float64 `json:"speed,omitempty"`
+	Volume           *float64 `json:"volume,omitempty"`
+	RequestID        *string  `json:"request_id,omitempty"`
+	UserID           *string  `json:"user_id,omitempty"`
+	WatermarkEnabled *bool    `json:"watermark_enabled,omitempty"`
+}
+
+// Speech converts text to audio. The audio is streamed from the response
+// body and must be closed after use.
+func (s *AudioService) Speech(ctx context.Context, req *AudioSpeechRequest, opts ...CallOption) (*BinaryResponse, error) {
+	if req.Model == "" {
+		return nil, &Error{Message: "model must be provided"}
+	}
+	if req.Input == "" {
+		return nil, &Error{Message: "input must be provided"}
+	}
+
+	resp, err := s.client.doRawRequest(ctx, http.MethodPost, "/audio/speech", req, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBinaryResponse(resp), nil
+}
+
+// Transcriptions transcribes an audio file into text
+func (s *AudioService) Transcriptions(ctx context.Context, req *AudioTranscriptionRequest, opts ...CallOption) (*AudioTranscription, error) {
+	body, err := req.multipartBody(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var result AudioTranscription
+	err = s.client.doRequest(ctx, http.MethodPost, "/audio/transcriptions", body, &result, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// TranscriptionsStream transcribes an audio file, streaming the text as it is recognized
+func (s *AudioService) TranscriptionsStream(ctx context.Context, req *AudioTranscriptionRequest, opts ...CallOption) (*AudioTranscriptionStream, error) {
+	body, err := req.multipartBody(true)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.client.doStreamRequest(ctx, http.MethodPost, "/audio/transcriptions", body, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AudioTranscriptionStream{stream: reader}, nil
+}
+
+// multipartBody encodes the request as a multipart form
+func (r *AudioTranscriptionRequest) multipartBody(stream bool) (*multipartBody, error) {
+	if r.Model == "" {
+		return nil, &Error{Message: "model must be provided"}
+	}
+
+	file, filename := r.File, r.Filename
+	if file == nil {
+		if r.FilePath == "" {
+			return nil, &Error{Message: "file or file path must be provided"}
+		}
+		f, err := os.Open(r.FilePath)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to open audio file: %v", err)}
+		}
+		defer f.Close()
+		file = f
+		if filename == "" {
+			filename = filepath.Base(r.FilePath)
+		}
+	}
+	if filename == "" {
+		filename = "audio"
+	}
+
+	fields := map[string]string{"model": r.Model}
+	if stream {
+		fields["stream"] = "true"
+	}
+	if r.Language != nil {
+		fields["language"] = *r.Language
+	}
+	if r.Prompt != nil {
+		fields["prompt"] = *r.Prompt
+	}
+	if r.Temperature != nil {
+		fields["temperature"] = strconv.FormatFloat(*r.Temperature, 'f', -1, 64)
+	}
+	if r.RequestID != nil {
+		fields["request_id"] = *r.RequestID
+	}
+	if r.UserID != nil {
+		fields["user_id"] = *r.UserID
+	}
+
+	return newMultipartBody(fields, "file", filename, file)
+}
+
+// Helper function to create a text-to-speech request
+func NewAudioSpeechRequest(model, input, voice string) *AudioSpeechRequest {
+	return &AudioSpeechRequest{
+		Model: model,
+		Input: input,
+		Voice: &voice,
+	}
+}
+
+// Helper function to create a transcription request for an audio file on disk
+func NewAudioTranscriptionRequest(model, filePath string) *AudioTranscriptionRequest {
+	return &AudioTranscriptionRequest{
+		Model:    model,
+		FilePath: filePath,
+	}
+}
@@ -0,0 +1,98 @@
+package zai
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenTTL is the lifetime of a signed API token
+	tokenTTL = 3 * time.Minute
+	// tokenRefreshMargin is how long before expiry a cached token is replaced
+	tokenRefreshMargin = 30 * time.Second
+)
+
+// tokenCache caches the signed token of each API key until shortly before it
+// expires. It is safe for concurrent use.
+type tokenCache struct {
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+// cachedToken is a signed token and its expiry
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// get returns a valid token for apiKey, signing a new one when the cached
+// token is missing or about to expire. Keys not in "id.secret" format are
+// returned unchanged.
+func (c *tokenCache) get(apiKey string) string {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.tokens[apiKey]; ok && now.Add(tokenRefreshMargin).Before(cached.expiresAt) {
+		return cached.token
+	}
+
+	token, ok := signToken(apiKey, now, tokenTTL)
+	if !ok {
+		return apiKey
+	}
+
+	if c.tokens == nil {
+		c.tokens = map[string]cachedToken{}
+	}
+	// Drop tokens of keys that are no longer in use
+	for key, cached := range c.tokens {
+		if now.After(cached.expiresAt) {
+			delete(c.tokens, key)
+		}
+	}
+	c.tokens[apiKey] = cachedToken{token: token, expiresAt: now.Add(tokenTTL)}
+	return token
+}
+
+// invalidate discards the cached token for apiKey
+func (c *tokenCache) invalidate(apiKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.tokens, apiKey)
+}
+
+// signToken signs a short-lived HS256 JWT from an API key in "id.secret"
+// format, as expected by the platform. It reports false if the key is not in
+// that format.
+func signToken(apiKey string, now time.Time, ttl time.Duration) (string, bool) {
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+
+	header, _ := json.Marshal(map[string]string{
+		"alg":       "HS256",
+		"sign_type": "SIGN",
+	})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"api_key":   id,
+		"exp":       now.Add(ttl).UnixMilli(),
+		"timestamp": now.UnixMilli(),
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return signingInput + "." + signature, true
+}
@@ -0,0 +1,325 @@
+package zai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// callState is the state shared by the attempts of an API call and, for
+// streams, the reader of the response. It feeds the rate limiter, the hooks
+// registered by middleware, metrics and the log.
+type callState struct {
+	ctx         context.Context
+	method      string
+	metrics     MetricsRecorder
+	logger      *slog.Logger
+	reservation *rateReservation
+	metadata    *ResponseMetadata
+	hooks       *callHooks
+	cancel      context.CancelFunc // Releases the call timeout, if any
+	start       time.Time
+
+	mu            sync.Mutex
+	info          CallMetrics
+	attemptStart  time.Time
+	firstChunk    time.Time
+	finishReasons []string
+	usage         *CompletionUsage
+	done          bool
+}
+
+// startCall starts recording call and waits for its rate limit budget
+func (c *BaseClient) startCall(ctx context.Context, call *APICall, opts *callOptions) (context.Context, *callState, error) {
+	state := &callState{
+		method:   call.Method,
+		metrics:  c.metrics,
+		logger:   c.logger,
+		metadata: opts.metadata,
+		hooks:    call.hooks,
+		start:    time.Now(),
+		info: CallMetrics{
+			Operation: call.Operation,
+			Model:     call.Model,
+			Path:      call.Path,
+			Stream:    call.Stream,
+		},
+	}
+	if opts.timeout > 0 {
+		ctx, state.cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	state.ctx = ctx
+	state.logStart()
+
+	reservation, err := c.reserve(ctx, call.Body)
+	if err != nil {
+		state.finish(nil, err)
+		return ctx, nil, err
+	}
+	state.reservation = reservation
+	return ctx, state, nil
+}
+
+// startAttempt records the start of an attempt, the first one being 0, and
+// runs the attempt hooks. It returns the context of the attempt and the
+// functions to call with its outcome.
+func (s *callState) startAttempt(ctx context.Context, attempt int) (context.Context, []func(error)) {
+	s.mu.Lock()
+	s.info.Attempts++
+	s.attemptStart = time.Now()
+	s.mu.Unlock()
+
+	if s.hooks == nil || len(s.hooks.attempt) == 0 {
+		return ctx, nil
+	}
+
+	header := http.Header{}
+	var ends []func(error)
+	for _, hook := range s.hooks.attempt {
+		var end func(error)
+		ctx, end = hook(ctx, attempt, header)
+		if end != nil {
+			ends = append(ends, end)
+		}
+	}
+	if len(header) > 0 {
+		ctx = context.WithValue(ctx, attemptHeaderKey{}, header)
+	}
+	return ctx, ends
+}
+
+// endAttempt records the outcome of an attempt
+func (s *callState) endAttempt(ends []func(error), err error) {
+	s.mu.Lock()
+	s.info.StatusCode = statusCode(err)
+	attempt, start := s.info.Attempts-1, s.attemptStart
+	s.mu.Unlock()
+
+	if apiErr := baseError(err); apiErr != nil && apiErr.header != nil {
+		s.recordMetadata(apiErr.StatusCode, apiErr.header, nil)
+	}
+
+	for i := len(ends) - 1; i >= 0; i-- {
+		ends[i](err)
+	}
+	s.logAttempt(attempt, start, err)
+}
+
+// retry records a retry that is about to happen
+func (s *callState) retry(attempt RetryAttempt) {
+	s.logRetry(attempt)
+	if s.metrics != nil {
+		s.metrics.RecordRetry(RetryMetrics{
+			Operation: s.info.Operation,
+			Model:     s.info.Model,
+			Path:      s.info.Path,
+			Attempt:   attempt.Attempt,
+			ErrorKind: ErrorKind(attempt.Err),
+		})
+	}
+}
+
+// response records the response of a successful attempt. body is the
+// undecoded body, or nil for streaming and binary responses.
+func (s *callState) response(resp *http.Response, body []byte) {
+	s.recordMetadata(resp.StatusCode, resp.Header, body)
+}
+
+// recordMetadata fills the response metadata requested by the caller
+func (s *callState) recordMetadata(status int, header http.Header, body []byte) {
+	if s.metadata == nil {
+		return
+	}
+
+	s.mu.Lock()
+	attempts := s.info.Attempts
+	s.mu.Unlock()
+
+	*s.metadata = ResponseMetadata{
+		StatusCode: status,
+		Header:     header,
+		RequestID:  requestIDFromHeader(header),
+		RateLimit:  parseRateLimitInfo(header),
+		Latency:    time.Since(s.start),
+		Attempts:   attempts,
+		RawBody:    body,
+	}
+}
+
+// chunk records a chunk of a streamed response. chunk is nil for endpoints
+// other than chat completions.
+func (s *callState) chunk(chunk *ChatCompletionChunk) {
+	if s == nil {
+		return
+	}
+
+	var usage *CompletionUsage
+	s.mu.Lock()
+	if s.firstChunk.IsZero() {
+		s.firstChunk = time.Now()
+	}
+	if chunk != nil {
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				s.finishReasons = append(s.finishReasons, *choice.FinishReason)
+			}
+		}
+		if chunk.Usage != nil {
+			s.usage, usage = chunk.Usage, chunk.Usage
+		}
+	}
+	s.mu.Unlock()
+
+	if usage != nil {
+		s.reservation.settle(usage, nil)
+	}
+}
+
+// finish records the decoded response or the error the call ended with.
+// Only the first call has an effect.
+func (s *callState) finish(result interface{}, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+	s.done = true
+
+	m := s.info
+	m.Duration = time.Since(s.start)
+	if !s.firstChunk.IsZero() {
+		m.TimeToFirstChunk = s.firstChunk.Sub(s.start)
+	}
+	m.FinishReasons = s.finishReasons
+	m.Usage = s.usage
+	s.mu.Unlock()
+
+	switch r := result.(type) {
+	case *ChatCompletion:
+		for _, choice := range r.Choices {
+			m.FinishReasons = append(m.FinishReasons, choice.FinishReason)
+		}
+	}
+	if usage := responseUsage(result); usage != nil {
+		m.Usage = usage
+	}
+	if err != nil && err != errStreamClosed {
+		m.Err = err
+		m.ErrorKind = ErrorKind(err)
+		if code := statusCode(err); code != 0 {
+			m.StatusCode = code
+		}
+	}
+
+	if s.metadata != nil && m.Err != nil && s.metadata.StatusCode == 0 {
+		s.metadata.Latency, s.metadata.Attempts = m.Duration, m.Attempts
+	}
+
+	s.reservation.settle(m.Usage, err)
+	s.logFinish(&m)
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if s.metrics != nil {
+		s.metrics.RecordCall(m)
+	}
+	if s.hooks != nil {
+		for _, fn := range s.hooks.finish {
+			fn(m)
+		}
+	}
+}
+
+// releaseTimeout hands the call timeout over to body, which releases it when
+// closed, so finishing the call does not cut off reading the body
+func (s *callState) releaseTimeout(body io.ReadCloser) io.ReadCloser {
+	if s.cancel == nil {
+		return body
+	}
+	cancel := s.cancel
+	s.cancel = nil
+	return &cancelOnClose{ReadCloser: body, cancel: cancel}
+}
+
+// cancelOnClose calls cancel once the body it wraps is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// statusCode returns the HTTP status of the response an attempt ended with:
+// the status carried by err, 200 on success or 0 if there was no response
+func statusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if apiErr := baseError(err); apiErr != nil {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// errStreamClosed ends the call of a stream closed before it was fully read
+var errStreamClosed = errors.New("stream closed")
+
+// operationName returns the GenAI operation name of an endpoint
+func operationName(path string) string {
+	switch path {
+	case "/chat/completions":
+		return "chat"
+	case "/embeddings":
+		return "embeddings"
+	}
+
+	// "/images/generations" -> "images.generations"; IDs are dropped
+	var parts []string
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part != "" && !strings.ContainsAny(part, "0123456789") {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// requestModel returns the Model field of a typed request, if any
+func requestModel(body interface{}) string {
+	v := reflect.ValueOf(body)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	field := v.FieldByName("Model")
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+	if field.Kind() != reflect.String {
+		return ""
+	}
+	return field.String()
+}
@@ -1,12 +1,9 @@
 package zai
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 )
@@ -18,13 +15,16 @@ type ChatService struct {
 
 // Message represents a chat message
 type Message struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"` // Can be string or array of content parts
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"` // Can be string or array of content parts
+	Name       string      `json:"name,omitempty"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`   // Tool calls made by the assistant
+	ToolCallID string      `json:"tool_call_id,omitempty"` // ID of the tool call a "tool" message answers
 }
 
 // ContentPart represents a part of multimodal content
 type ContentPart struct {
-	Type     string    `json:"type"`      // "text" or "image_url"
+	Type     string    `json:"type"` // "text" or "image_url"
 	Text     string    `json:"text,omitempty"`
 	ImageURL *ImageURL `json:"image_url,omitempty"`
 }
@@ -42,6 +42,7 @@ type Function struct {
 
 // ToolCall represents a tool call in a message
 type ToolCall struct {
+	Index    *int     `json:"index,omitempty"` // Position of the call, set on streaming deltas
 	ID       string   `json:"id"`
 	Type     string   `json:"type"`
 	Function Function `json:"function"`
@@ -55,6 +56,22 @@ type CompletionMessage struct {
 	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 }
 
+// ToMessage converts a completion message into a Message so it can be
+// appended to the conversation, preserving any tool calls
+func (m CompletionMessage) ToMessage() Message {
+	msg := Message{
+		Role:      m.Role,
+		ToolCalls: m.ToolCalls,
+	}
+	if msg.Role == "" {
+		msg.Role = "assistant"
+	}
+	if m.Content != nil {
+		msg.Content = *m.Content
+	}
+	return msg
+}
+
 // PromptTokensDetails represents detailed token usage for prompts
 type PromptTokensDetails struct {
 	CachedTokens int `json:"cached_tokens"`
@@ -92,17 +109,18 @@ type ChatCompletion struct {
 
 // ChatCompletionChunk represents a streaming chunk
 type ChatCompletionChunk struct {
-	ID      string                    `json:"id"`
-	Created int64                     `json:"created"`
-	Model   string                    `json:"model"`
+	ID      string                      `json:"id"`
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
 	Choices []ChatCompletionChunkChoice `json:"choices"`
+	Usage   *CompletionUsage            `json:"usage,omitempty"`
 }
 
 // ChatCompletionChunkChoice represents a streaming choice
 type ChatCompletionChunkChoice struct {
-	Index        int                         `json:"index"`
-	Delta        ChatCompletionChunkDelta    `json:"delta"`
-	FinishReason *string                     `json:"finish_reason,omitempty"`
+	Index        int                      `json:"index"`
+	Delta        ChatCompletionChunkDelta `json:"delta"`
+	FinishReason *string                  `json:"finish_reason,omitempty"`
 }
 
 // ChatCompletionChunkDelta represents the delta in a streaming chunk
@@ -115,9 +133,9 @@ type ChatCompletionChunkDelta struct {
 
 // Tool represents a tool that can be called
 type Tool struct {
-	Type      string                 `json:"type"`
-	Function  *FunctionDefinition    `json:"function,omitempty"`
-	WebSearch *WebSearchTool         `json:"web_search,omitempty"`
+	Type      string              `json:"type"`
+	Function  *FunctionDefinition `json:"function,omitempty"`
+	WebSearch *WebSearchTool      `json:"web_search,omitempty"`
 }
 
 // FunctionDefinition represents a function definition
@@ -155,7 +173,7 @@ type ChatCompletionRequest struct {
 	Tools              []Tool              `json:"tools,omitempty"`
 	ToolChoice         *string             `json:"tool_choice,omitempty"`
 	Meta               map[string]string   `json:"meta,omitempty"`
-	ResponseFormat     interface{}         `json:"response_format,omitempty"`
+	ResponseFormat     interface{}         `json:"response_format,omitempty"` // *ResponseFormat or a raw map
 	Thinking           interface{}         `json:"thinking,omitempty"`
 	WatermarkEnabled   *bool               `json:"watermark_enabled,omitempty"`
 	ToolStream         *bool               `json:"tool_stream,omitempty"`
@@ -163,84 +181,38 @@ type ChatCompletionRequest struct {
 
 // ChatCompletionStream represents a streaming response
 type ChatCompletionStream struct {
-	reader  *bufio.Reader
-	response *http.Response
+	stream *streamReader
 }
 
 // Next reads the next chunk from the stream
 func (s *ChatCompletionStream) Next() (*ChatCompletionChunk, error) {
-	for {
-		line, err := s.reader.ReadBytes('\n')
-		if err != nil {
-			if err == io.EOF {
-				return nil, io.EOF
-			}
-			return nil, fmt.Errorf("failed to read stream: %w", err)
-		}
-
-		line = bytes.TrimSpace(line)
-		if len(line) == 0 {
-			continue
-		}
-
-		// SSE format: "data: {...}"
-		if !bytes.HasPrefix(line, []byte("data: ")) {
-			continue
-		}
-
-		data := bytes.TrimPrefix(line, []byte("data: "))
-
-		// Check for stream end
-		if bytes.Equal(data, []byte("[DONE]")) {
-			return nil, io.EOF
-		}
-
-		var chunk ChatCompletionChunk
-		if err := json.Unmarshal(data, &chunk); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal chunk: %w", err)
-		}
+	data, err := s.stream.next()
+	if err != nil {
+		return nil, err
+	}
 
-		return &chunk, nil
+	var chunk ChatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		err = fmt.Errorf("failed to unmarshal chunk: %w", err)
+		s.stream.state.finish(nil, err)
+		return nil, err
 	}
+	s.stream.state.chunk(&chunk)
+
+	return &chunk, nil
 }
 
 // Close closes the stream
 func (s *ChatCompletionStream) Close() error {
-	if s.response != nil && s.response.Body != nil {
-		return s.response.Body.Close()
-	}
-	return nil
+	return s.stream.close()
 }
 
 // CreateChatCompletion creates a chat completion
-func (s *ChatService) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletion, error) {
-	// Validate and adjust temperature and top_p
-	if req.Temperature != nil {
-		temp := *req.Temperature
-		if temp <= 0 {
-			doSample := false
-			req.DoSample = &doSample
-			temp = 0.01
-			req.Temperature = &temp
-		} else if temp >= 1 {
-			temp = 0.99
-			req.Temperature = &temp
-		}
-	}
-
-	if req.TopP != nil {
-		topP := *req.TopP
-		if topP <= 0 {
-			topP = 0.01
-			req.TopP = &topP
-		} else if topP >= 1 {
-			topP = 0.99
-			req.TopP = &topP
-		}
-	}
+func (s *ChatService) CreateChatCompletion(ctx context.Context, req *ChatCompletionRequest, opts ...CallOption) (*ChatCompletion, error) {
+	normalizeSampling(req)
 
 	var result ChatCompletion
-	err := s.client.doRequest(ctx, http.MethodPost, "/chat/completions", req, &result)
+	err := s.client.doRequest(ctx, http.MethodPost, "/chat/completions", req, &result, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -249,12 +221,24 @@ func (s *ChatService) CreateChatCompletion(ctx context.Context, req *ChatComplet
 }
 
 // CreateChatCompletionStream creates a streaming chat completion
-func (s *ChatService) CreateChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionStream, error) {
+func (s *ChatService) CreateChatCompletionStream(ctx context.Context, req *ChatCompletionRequest, opts ...CallOption) (*ChatCompletionStream, error) {
 	// Set stream to true
 	stream := true
 	req.Stream = &stream
 
-	// Validate and adjust temperature and top_p
+	normalizeSampling(req)
+
+	reader, err := s.client.doStreamRequest(ctx, http.MethodPost, "/chat/completions", req, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChatCompletionStream{stream: reader}, nil
+}
+
+// normalizeSampling validates and adjusts temperature and top_p to the
+// open interval (0, 1) accepted by the API
+func normalizeSampling(req *ChatCompletionRequest) {
 	if req.Temperature != nil {
 		temp := *req.Temperature
 		if temp <= 0 {
@@ -278,57 +262,6 @@ func (s *ChatService) CreateChatCompletionStream(ctx context.Context, req *ChatC
 			req.TopP = &topP
 		}
 	}
-
-	url := s.client.baseURL + "/chat/completions"
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, &Error{Message: fmt.Sprintf("failed to marshal request body: %v", err)}
-	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, &Error{Message: fmt.Sprintf("failed to create request: %v", err)}
-	}
-
-	// Set headers
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+s.client.apiKey)
-	httpReq.Header.Set("x-source-channel", s.client.sourceChannel)
-	httpReq.Header.Set("Accept", "text/event-stream")
-
-	// Add custom headers
-	for key, value := range s.client.customHeaders {
-		httpReq.Header.Set(key, value)
-	}
-
-	resp, err := s.client.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, &APITimeoutError{Err: &Error{Message: fmt.Sprintf("request failed: %v", err)}}
-	}
-
-	// Check for errors
-	if resp.StatusCode >= 400 {
-		defer resp.Body.Close()
-		respBody, _ := io.ReadAll(resp.Body)
-
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-				Type    string `json:"type"`
-				Code    string `json:"code"`
-			} `json:"error"`
-		}
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
-			return nil, NewError(resp.StatusCode, errResp.Error.Message, errResp.Error.Type, errResp.Error.Code)
-		}
-		return nil, NewError(resp.StatusCode, string(respBody), "", "")
-	}
-
-	return &ChatCompletionStream{
-		reader:   bufio.NewReader(resp.Body),
-		response: resp,
-	}, nil
 }
 
 // Helper function to create a simple text message
@@ -355,6 +288,15 @@ func NewAssistantMessage(content string) Message {
 	}
 }
 
+// Helper function to create a tool result message answering a tool call
+func NewToolResultMessage(callID, content string) Message {
+	return Message{
+		Role:       "tool",
+		Content:    content,
+		ToolCallID: callID,
+	}
+}
+
 // Helper function to create a multimodal message with text and image
 func NewMultimodalMessage(role, text, imageURL string) Message {
 	content := []ContentPart{
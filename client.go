@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 )
 
@@ -28,20 +32,34 @@ type ClientConfig struct {
 	BaseURL            string
 	HTTPClient         *http.Client
 	MaxRetries         int
-	DisableTokenCache  bool
+	DisableTokenCache  bool // Send the raw API key instead of a cached, signed JWT
 	SourceChannel      string
 	CustomHeaders      map[string]string
+	RetryPolicy        *RetryPolicy
+	Credentials        CredentialsProvider // Resolves the API key per request; overrides APIKey
+	Middleware         []Middleware        // Wraps every API call; the first entry is outermost
+	RateLimiter        *RateLimiter        // Paces Chat and Embeddings requests per model
+	Metrics            MetricsRecorder     // Receives measurements of every call, e.g. a *MetricsCollector
+	Logger             *slog.Logger        // Logs requests, retries and failures when set
+	LogBodies          bool                // Also log request and response bodies at debug level, with credentials redacted
 }
 
 // BaseClient is the base client for ZAI API
 type BaseClient struct {
-	apiKey            string
+	credentials       CredentialsProvider
 	baseURL           string
 	httpClient        *http.Client
 	maxRetries        int
 	disableTokenCache bool
 	sourceChannel     string
 	customHeaders     map[string]string
+	retryPolicy       RetryPolicy
+	tokens            *tokenCache
+	middleware        []Middleware
+	rateLimiter       *RateLimiter
+	metrics           MetricsRecorder
+	logger            *slog.Logger
+	logBodies         bool
 }
 
 // Client is the main client for ZAI API (overseas regions)
@@ -72,7 +90,7 @@ func NewClient(apiKey string, config ...*ClientConfig) (*Client, error) {
 	if cfg.APIKey == "" {
 		cfg.APIKey = os.Getenv("ZAI_API_KEY")
 	}
-	if cfg.APIKey == "" {
+	if cfg.APIKey == "" && cfg.Credentials == nil {
 		return nil, &Error{Message: "api_key not provided, please provide it through parameters or environment variables"}
 	}
 
@@ -98,7 +116,7 @@ func NewZhipuClient(apiKey string, config ...*ClientConfig) (*ZhipuClient, error
 	if cfg.APIKey == "" {
 		cfg.APIKey = os.Getenv("ZAI_API_KEY")
 	}
-	if cfg.APIKey == "" {
+	if cfg.APIKey == "" && cfg.Credentials == nil {
 		return nil, &Error{Message: "api_key not provided, please provide it through parameters or environment variables"}
 	}
 
@@ -155,70 +173,344 @@ func newBaseClient(cfg *ClientConfig) *BaseClient {
 		}
 	}
 
+	credentials := cfg.Credentials
+	if credentials == nil {
+		credentials = StaticCredentials(cfg.APIKey)
+	}
+
 	return &BaseClient{
-		apiKey:            cfg.APIKey,
+		credentials:       credentials,
 		baseURL:           cfg.BaseURL,
 		httpClient:        cfg.HTTPClient,
 		maxRetries:        cfg.MaxRetries,
 		disableTokenCache: cfg.DisableTokenCache,
 		sourceChannel:     cfg.SourceChannel,
 		customHeaders:     cfg.CustomHeaders,
+		retryPolicy:       cfg.RetryPolicy.withDefaults(),
+		tokens:            &tokenCache{},
+		middleware:        cfg.Middleware,
+		rateLimiter:       cfg.RateLimiter,
+		metrics:           cfg.Metrics,
+		logger:            cfg.Logger,
+		logBodies:         cfg.LogBodies,
 	}
 }
 
 // doRequest performs an HTTP request with retry logic
-func (c *BaseClient) doRequest(ctx context.Context, method, path string, body interface{}, result interface{}) error {
-	var lastErr error
+func (c *BaseClient) doRequest(ctx context.Context, method, path string, body interface{}, result interface{}, opts ...CallOption) error {
+	call, options := c.newCall(method, path, body, false, opts)
+	ctx, state, err := c.startCall(ctx, call, options)
+	if err != nil {
+		return err
+	}
+
+	out, err := c.handle(ctx, call, func(ctx context.Context, call *APICall) (interface{}, error) {
+		err := c.withRetry(ctx, call, state, func(ctx context.Context) error {
+			return c.doRequestOnce(ctx, call, state, result)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	})
+	if err == nil {
+		err = setResult(result, out)
+	}
+	if err != nil {
+		state.finish(nil, err)
+		return err
+	}
+
+	state.finish(result, nil)
+	return nil
+}
+
+// newCall builds the description of a call from the client settings and opts
+func (c *BaseClient) newCall(method, path string, body interface{}, stream bool, opts []CallOption) (*APICall, *callOptions) {
+	call := &APICall{
+		Method:     method,
+		Path:       path,
+		Operation:  operationName(path),
+		Model:      requestModel(body),
+		Body:       body,
+		Header:     http.Header{},
+		Stream:     stream,
+		BaseURL:    c.baseURL,
+		MaxRetries: c.maxRetries,
+		hooks:      &callHooks{},
+	}
+	if stream {
+		call.Header.Set("Accept", "text/event-stream")
+	}
 
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+	options := newCallOptions(opts)
+	options.apply(call)
+	return call, options
+}
+
+// withRetry calls fn until it succeeds, fails with a non-retryable error or
+// the retry budget is exhausted, waiting between attempts as set by the
+// retry policy. An attempt rejected for its credentials is repeated right
+// away when the credentials provider has a different key, without using up
+// the retry budget. Every attempt is recorded in the state of the call.
+func (c *BaseClient) withRetry(ctx context.Context, call *APICall, state *callState, fn func(ctx context.Context) error) error {
+	var (
+		lastErr    error
+		retries    int  // Retries taken from the MaxRetries budget
+		refreshes  int  // Attempts repeated with different credentials
+		refreshing bool // The next attempt uses refreshed credentials
+	)
+
+	// The first attempt is made even if middleware set a negative MaxRetries
+	for attempt := 0; ; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff
-			backoff := time.Duration(attempt) * time.Second
+			retry := RetryAttempt{
+				Method:  call.Method,
+				Path:    call.Path,
+				Attempt: attempt,
+				Err:     lastErr,
+			}
+			if !refreshing {
+				retry.Delay = c.retryPolicy.delay(retries, lastErr)
+			}
+			if c.retryPolicy.OnRetry != nil {
+				c.retryPolicy.OnRetry(retry)
+			}
+			state.retry(retry)
+
+			timer := time.NewTimer(retry.Delay)
 			select {
 			case <-ctx.Done():
+				timer.Stop()
 				return ctx.Err()
-			case <-time.After(backoff):
+			case <-timer.C:
+			}
+
+			if err := state.reservation.retry(ctx); err != nil {
+				return err
 			}
 		}
 
-		err := c.doRequestOnce(ctx, method, path, body, result)
+		attemptCtx, ends := state.startAttempt(ctx, attempt)
+		err := fn(attemptCtx)
+		state.endAttempt(ends, err)
 		if err == nil {
 			return nil
 		}
 
 		lastErr = err
+		if ctx.Err() != nil {
+			return err
+		}
 
-		// Don't retry on certain errors
-		switch err.(type) {
-		case *APIAuthenticationError, *APIRequestFailedError:
+		refreshing = refreshes < maxCredentialRefreshes && credentialsRefreshed(err)
+		if refreshing {
+			refreshes++
+			continue
+		}
+		if retries >= call.MaxRetries || !c.retryPolicy.shouldRetry(err) {
 			return err
 		}
+		retries++
 	}
+}
+
+// maxCredentialRefreshes bounds how often a call is repeated with different
+// credentials
+const maxCredentialRefreshes = 5
 
-	return lastErr
+// credentialsRefreshed reports whether err is an error the credentials
+// provider can cure by supplying a different key, such as an authentication
+// failure after a key rotation
+func credentialsRefreshed(err error) bool {
+	apiErr := baseError(err)
+	return apiErr != nil && apiErr.retryCredentials
 }
 
 // doRequestOnce performs a single HTTP request
-func (c *BaseClient) doRequestOnce(ctx context.Context, method, path string, body interface{}, result interface{}) error {
-	url := c.baseURL + path
+func (c *BaseClient) doRequestOnce(ctx context.Context, call *APICall, state *callState, result interface{}) error {
+	resp, err := c.send(ctx, call)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return responseError(resp, fmt.Sprintf("failed to read response body: %v", err))
+	}
+	state.response(resp, respBody)
+
+	// Parse response
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return responseError(resp, fmt.Sprintf("failed to unmarshal response: %v", err))
+		}
+	}
+
+	return nil
+}
+
+// responseError returns an error about a response that could not be
+// processed, carrying its status and request ID
+func responseError(resp *http.Response, message string) error {
+	return &Error{
+		Message:    message,
+		StatusCode: resp.StatusCode,
+		RequestID:  requestIDFromHeader(resp.Header),
+		header:     resp.Header,
+	}
+}
+
+// doRawRequest performs an HTTP request with retry logic and returns the
+// undecoded response. The caller is responsible for closing the response body.
+func (c *BaseClient) doRawRequest(ctx context.Context, method, path string, body interface{}, opts ...CallOption) (*http.Response, error) {
+	call, options := c.newCall(method, path, body, false, opts)
+	ctx, state, err := c.startCall(ctx, call, options)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRaw(ctx, call, state)
+	if err == nil {
+		// The call timeout, if any, keeps running until the body is closed
+		resp.Body = state.releaseTimeout(resp.Body)
+	}
+	state.finish(nil, err)
+	return resp, err
+}
+
+// doStreamRequest performs a server-sent events request. Failures that occur
+// before the stream starts are retried like any other request; errors after
+// that are reported by the returned reader.
+func (c *BaseClient) doStreamRequest(ctx context.Context, method, path string, body interface{}, opts ...CallOption) (*streamReader, error) {
+	call, options := c.newCall(method, path, body, true, opts)
+	ctx, state, err := c.startCall(ctx, call, options)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRaw(ctx, call, state)
+	if err != nil {
+		state.finish(nil, err)
+		return nil, err
+	}
+
+	reader := newStreamReader(resp)
+	reader.state = state
+	return reader, nil
+}
+
+// doRaw performs call with retry logic and returns the undecoded response
+func (c *BaseClient) doRaw(ctx context.Context, call *APICall, state *callState) (*http.Response, error) {
+	out, err := c.handle(ctx, call, func(ctx context.Context, call *APICall) (interface{}, error) {
+		var resp *http.Response
+		err := c.withRetry(ctx, call, state, func(ctx context.Context) error {
+			var err error
+			resp, err = c.send(ctx, call)
+			if err == nil {
+				state.response(resp, nil)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := out.(*http.Response)
+	if !ok || resp == nil {
+		return nil, &Error{Message: fmt.Sprintf("middleware returned %T for %s, want *http.Response", out, call.Path)}
+	}
+	return resp, nil
+}
+
+// send builds and dispatches a single HTTP request. Responses with an error
+// status are consumed and converted into typed errors; otherwise the response
+// is returned with its body unread. call.Header and the headers added by
+// attempt hooks are set on the request after the default headers.
+func (c *BaseClient) send(ctx context.Context, call *APICall) (*http.Response, error) {
+	url := call.BaseURL + call.Path
 
 	var reqBody io.Reader
-	if body != nil {
-		jsonData, err := json.Marshal(body)
+	var jsonData []byte
+	contentType := "application/json"
+	switch b := call.Body.(type) {
+	case nil:
+	case *multipartBody:
+		// The encoded form is kept in memory so every attempt reads it from the start
+		reqBody = bytes.NewReader(b.data)
+		contentType = b.contentType
+	default:
+		var err error
+		jsonData, err = json.Marshal(call.Body)
+		if err == nil && len(call.ExtraFields) > 0 {
+			jsonData, err = mergeFields(jsonData, call.ExtraFields)
+		}
 		if err != nil {
-			return &Error{Message: fmt.Sprintf("failed to marshal request body: %v", err)}
+			return nil, &Error{Message: fmt.Sprintf("failed to marshal request body: %v", err)}
 		}
 		reqBody = bytes.NewBuffer(jsonData)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	req, err := http.NewRequestWithContext(ctx, call.Method, url, reqBody)
 	if err != nil {
-		return &Error{Message: fmt.Sprintf("failed to create request: %v", err)}
+		return nil, &Error{Message: fmt.Sprintf("failed to create request: %v", err)}
 	}
 
 	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", contentType)
+	apiKey, err := c.setHeaders(req)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range call.Header {
+		req.Header[key] = values
+	}
+	for key, values := range attemptHeader(ctx) {
+		req.Header[key] = values
+	}
+	c.logRequestBody(req, call.Body, jsonData, apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, newTransportError(err)
+	}
+	c.logResponseBody(ctx, resp, apiKey)
+
+	// Check for errors
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		err := parseErrorResponse(resp)
+		if apiErr := baseError(err); apiErr != nil {
+			apiErr.RetryAfter = parseRetryAfter(resp.Header)
+			apiErr.RequestID = requestIDFromHeader(resp.Header)
+			apiErr.header = resp.Header
+			apiErr.retryCredentials = c.rejectCredentials(ctx, apiKey, err)
+		}
+		return nil, err
+	}
+
+	if observer, ok := c.credentials.(CredentialsObserver); ok {
+		observer.ReportResult(apiKey, nil)
+	}
+
+	return resp, nil
+}
+
+// setHeaders sets the authentication, source channel and custom headers on
+// req. It returns the API key the request was authenticated with.
+func (c *BaseClient) setHeaders(req *http.Request) (string, error) {
+	apiKey, err := c.credentials.APIKey(req.Context())
+	if err != nil {
+		return "", &Error{Message: fmt.Sprintf("failed to resolve credentials: %v", err), cause: err}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.authToken(apiKey))
 	req.Header.Set("x-source-channel", c.sourceChannel)
 
 	// Add custom headers
@@ -226,38 +518,130 @@ func (c *BaseClient) doRequestOnce(ctx context.Context, method, path string, bod
 		req.Header.Set(key, value)
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return &APITimeoutError{Err: &Error{Message: fmt.Sprintf("request failed: %v", err)}}
+	return apiKey, nil
+}
+
+// authToken returns the bearer token for apiKey: a cached signed JWT, or the
+// raw key when the token cache is disabled
+func (c *BaseClient) authToken(apiKey string) string {
+	if c.disableTokenCache {
+		return apiKey
 	}
-	defer resp.Body.Close()
+	return c.tokens.get(apiKey)
+}
+
+// rejectCredentials tells the credentials provider that the API rejected a
+// request made with apiKey. It reports whether retrying right away with
+// freshly resolved credentials may succeed, which is only the case when the
+// provider now supplies a different key.
+func (c *BaseClient) rejectCredentials(ctx context.Context, apiKey string, err error) bool {
+	authFailed := errors.Is(err, ErrAuthentication)
+	inv, invalidator := c.credentials.(CredentialsInvalidator)
+	if authFailed {
+		c.tokens.invalidate(apiKey)
+		if invalidator {
+			inv.Invalidate(apiKey)
+		}
+	}
+
+	// An observer knows best whether another key is available
+	if observer, ok := c.credentials.(CredentialsObserver); ok {
+		return observer.ReportResult(apiKey, err)
+	}
+	if !authFailed || !invalidator {
+		return false
+	}
+
+	next, resolveErr := c.credentials.APIKey(ctx)
+	return resolveErr == nil && next != apiKey
+}
+
+// requestIDHeaders are the response headers that may carry the server request ID
+var requestIDHeaders = []string{"X-Request-Id", "Request-Id", "X-Log-Id"}
+
+// requestIDFromHeader returns the server request ID from response headers, if any
+func requestIDFromHeader(header http.Header) string {
+	for _, key := range requestIDHeaders {
+		if id := header.Get(key); id != "" {
+			return id
+		}
+	}
+	return ""
+}
 
+// parseErrorResponse converts an error response into a typed error
+func parseErrorResponse(resp *http.Response) error {
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return &Error{Message: fmt.Sprintf("failed to read response body: %v", err)}
 	}
 
-	// Check for errors
-	if resp.StatusCode >= 400 {
-		var errResp struct {
-			Error struct {
-				Message string `json:"message"`
-				Type    string `json:"type"`
-				Code    string `json:"code"`
-			} `json:"error"`
+	var errResp errorResponse
+	if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error != nil && errResp.Error.Message != "" {
+		return errResp.Error.toError(resp.StatusCode)
+	}
+	return NewError(resp.StatusCode, string(respBody), "", "")
+}
+
+// mergeFields sets fields at the top level of the JSON object data
+func mergeFields(data []byte, fields map[string]interface{}) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		object = make(map[string]json.RawMessage, len(fields))
+	}
+	for key, value := range fields {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
 		}
-		if err := json.Unmarshal(respBody, &errResp); err == nil && errResp.Error.Message != "" {
-			return NewError(resp.StatusCode, errResp.Error.Message, errResp.Error.Type, errResp.Error.Code)
+		object[key] = raw
+	}
+	return json.Marshal(object)
+}
+
+// multipartBody is a request body encoded as multipart/form-data
+type multipartBody struct {
+	contentType string
+	data        []byte
+}
+
+// newMultipartBody encodes the given form fields and file into a multipart body.
+// Fields are written in sorted key order so the encoding is deterministic.
+func newMultipartBody(fields map[string]string, fileField, fileName string, file io.Reader) (*multipartBody, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := w.WriteField(key, fields[key]); err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to write form field %s: %v", key, err)}
 		}
-		return NewError(resp.StatusCode, string(respBody), "", "")
 	}
 
-	// Parse response
-	if result != nil {
-		if err := json.Unmarshal(respBody, result); err != nil {
-			return &Error{Message: fmt.Sprintf("failed to unmarshal response: %v", err)}
+	if file != nil {
+		part, err := w.CreateFormFile(fileField, fileName)
+		if err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to create form file: %v", err)}
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			return nil, &Error{Message: fmt.Sprintf("failed to read file: %v", err)}
 		}
 	}
 
-	return nil
+	if err := w.Close(); err != nil {
+		return nil, &Error{Message: fmt.Sprintf("failed to encode multipart body: %v", err)}
+	}
+
+	return &multipartBody{
+		contentType: w.FormDataContentType(),
+		data:        buf.Bytes(),
+	}, nil
 }
@@ -0,0 +1,167 @@
+package zai
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialsProvider supplies the API key for each request. Implementations
+// must be safe for concurrent use. The context is the one passed to the
+// service method, so it can carry tenant information.
+type CredentialsProvider interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// CredentialsInvalidator is implemented by providers that cache credentials.
+// Invalidate is called with the rejected key when the API returns an
+// authentication error. If the provider then returns a different key, the
+// request is retried right away with it.
+type CredentialsInvalidator interface {
+	Invalidate(apiKey string)
+}
+
+// CredentialsObserver is implemented by providers that track how requests
+// made with their keys fare. ReportResult is called after every request with
+// the key used and nil on success or the API error on failure. It returns
+// true if the failure is specific to the key and the request should be
+// retried right away with another one.
+type CredentialsObserver interface {
+	ReportResult(apiKey string, err error) (retryWithOtherKey bool)
+}
+
+// StaticCredentials is a CredentialsProvider that always returns the same key
+type StaticCredentials string
+
+// APIKey returns the static key
+func (c StaticCredentials) APIKey(ctx context.Context) (string, error) {
+	if c == "" {
+		return "", &Error{Message: "api_key is empty"}
+	}
+	return string(c), nil
+}
+
+// EnvCredentials is a CredentialsProvider that reads the key from the named
+// environment variable on every request
+type EnvCredentials string
+
+// APIKey returns the current value of the environment variable
+func (c EnvCredentials) APIKey(ctx context.Context) (string, error) {
+	key := os.Getenv(string(c))
+	if key == "" {
+		return "", &Error{Message: fmt.Sprintf("environment variable %s is not set", string(c))}
+	}
+	return key, nil
+}
+
+// CredentialsFunc adapts a function into a CredentialsProvider
+type CredentialsFunc func(ctx context.Context) (string, error)
+
+// APIKey calls f
+func (f CredentialsFunc) APIKey(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// FileCredentials is a CredentialsProvider that reads the key from a file,
+// such as a mounted secret, and reloads it whenever the file changes
+type FileCredentials struct {
+	path string
+
+	mu      sync.Mutex
+	key     string
+	modTime time.Time
+	size    int64
+}
+
+// NewFileCredentials creates a provider reading the key from path. Surrounding
+// whitespace in the file is ignored.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{path: path}
+}
+
+// APIKey returns the key in the file, reloading it if the file was modified
+func (c *FileCredentials) APIKey(ctx context.Context) (string, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return "", &Error{Message: fmt.Sprintf("failed to read credentials file: %v", err)}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.key != "" && info.ModTime().Equal(c.modTime) && info.Size() == c.size {
+		return c.key, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return "", &Error{Message: fmt.Sprintf("failed to read credentials file: %v", err)}
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", &Error{Message: fmt.Sprintf("credentials file %s is empty", c.path)}
+	}
+
+	c.key, c.modTime, c.size = key, info.ModTime(), info.Size()
+	return key, nil
+}
+
+// Invalidate forces the file to be read again on the next request
+func (c *FileCredentials) Invalidate(apiKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.key == apiKey {
+		c.key = ""
+	}
+}
+
+// CachedCredentials wraps a slow provider, such as a secret store lookup,
+// and caches the key it returns for a fixed time
+type CachedCredentials struct {
+	provider CredentialsProvider
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	key       string
+	expiresAt time.Time
+}
+
+// NewCachedCredentials caches the keys returned by provider for ttl
+func NewCachedCredentials(provider CredentialsProvider, ttl time.Duration) *CachedCredentials {
+	return &CachedCredentials{provider: provider, ttl: ttl}
+}
+
+// APIKey returns the cached key, fetching a new one if it expired
+func (c *CachedCredentials) APIKey(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.key != "" && time.Now().Before(c.expiresAt) {
+		return c.key, nil
+	}
+
+	key, err := c.provider.APIKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.key, c.expiresAt = key, time.Now().Add(c.ttl)
+	return key, nil
+}
+
+// Invalidate discards the cached key so the next request fetches a new one
+func (c *CachedCredentials) Invalidate(apiKey string) {
+	c.mu.Lock()
+	if c.key == apiKey {
+		c.key = ""
+	}
+	c.mu.Unlock()
+
+	if inv, ok := c.provider.(CredentialsInvalidator); ok {
+		inv.Invalidate(apiKey)
+	}
+}
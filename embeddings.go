@@ -37,9 +37,9 @@ type EmbeddingsRequest struct {
 }
 
 // CreateEmbeddings creates embeddings for the given input
-func (s *EmbeddingsService) CreateEmbeddings(ctx context.Context, req *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+func (s *EmbeddingsService) CreateEmbeddings(ctx context.Context, req *EmbeddingsRequest, opts ...CallOption) (*EmbeddingsResponse, error) {
 	var result EmbeddingsResponse
-	err := s.client.doRequest(ctx, http.MethodPost, "/embeddings", req, &result)
+	err := s.client.doRequest(ctx, http.MethodPost, "/embeddings", req, &result, opts...)
 	if err != nil {
 		return nil, err
 	}
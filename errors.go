@@ -1,31 +1,131 @@
 package zai
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"reflect"
+	"time"
 )
 
+// Sentinel errors for use with errors.Is
+var (
+	// ErrRateLimited matches requests rejected by rate limiting
+	ErrRateLimited = errors.New("zai: rate limited")
+	// ErrAuthentication matches requests rejected for invalid credentials
+	ErrAuthentication = errors.New("zai: authentication failed")
+	// ErrQuotaExhausted matches requests rejected because the account balance
+	// or usage quota is used up
+	ErrQuotaExhausted = errors.New("zai: quota exhausted")
+)
+
+// errorKind classifies a platform business error code
+type errorKind int
+
+const (
+	kindUnknown errorKind = iota
+	kindAuthentication
+	kindInsufficientBalance
+	kindQuotaExceeded
+	kindContextLength
+	kindContentFilter
+	kindRateLimit
+)
+
+// businessCodes maps the platform business codes sent in error.code to their
+// kind. Codes not listed here are classified by HTTP status alone.
+var businessCodes = map[string]errorKind{
+	"1000": kindAuthentication,      // Authentication failed
+	"1001": kindAuthentication,      // Missing authentication header
+	"1002": kindAuthentication,      // Invalid token
+	"1003": kindAuthentication,      // Token expired
+	"1004": kindAuthentication,      // Token verification failed
+	"1113": kindInsufficientBalance, // Account in arrears
+	"1261": kindContextLength,       // Prompt too long
+	"1301": kindContentFilter,       // Unsafe or sensitive content
+	"1302": kindRateLimit,           // Too many concurrent requests
+	"1303": kindRateLimit,           // Request frequency too high
+	"1304": kindQuotaExceeded,       // Daily call limit reached
+	"1305": kindRateLimit,           // Too many requests for the API
+	"1308": kindQuotaExceeded,       // Usage limit reached
+	"1310": kindQuotaExceeded,       // Usage limit reached for the period
+}
+
+// ErrorInfo is implemented by *Error, and therefore reachable with errors.As
+// from every error type in this package
+type ErrorInfo interface {
+	error
+	HTTPStatusCode() int
+	ErrorType() string
+	ErrorCode() string
+	ServerRequestID() string
+}
+
 // Error represents a ZAI API error
 type Error struct {
 	Message    string `json:"message"`
 	StatusCode int    `json:"status_code,omitempty"`
 	Type       string `json:"type,omitempty"`
 	Code       string `json:"code,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	// RetryAfter is the delay requested by the server's Retry-After header, if any
+	RetryAfter time.Duration `json:"-"`
+
+	cause            error       // Underlying transport error, if any
+	header           http.Header // Headers of the error response, if any
+	retryCredentials bool        // Whether a retry with other credentials may succeed
 }
 
 func (e *Error) Error() string {
+	if e.StatusCode > 0 && e.RequestID != "" {
+		return fmt.Sprintf("zai: %s (status: %d, type: %s, code: %s, request_id: %s)", e.Message, e.StatusCode, e.Type, e.Code, e.RequestID)
+	}
 	if e.StatusCode > 0 {
 		return fmt.Sprintf("zai: %s (status: %d, type: %s, code: %s)", e.Message, e.StatusCode, e.Type, e.Code)
 	}
 	return fmt.Sprintf("zai: %s", e.Message)
 }
 
+// Unwrap returns the underlying transport error, if any
+func (e *Error) Unwrap() error { return e.cause }
+
+// Is reports whether e matches one of the sentinel errors
+func (e *Error) Is(target error) bool {
+	kind := businessCodes[e.Code]
+	switch target {
+	case ErrQuotaExhausted:
+		return kind == kindInsufficientBalance || kind == kindQuotaExceeded
+	case ErrRateLimited:
+		return kind == kindRateLimit || (kind == kindUnknown && e.StatusCode == http.StatusTooManyRequests)
+	case ErrAuthentication:
+		return kind == kindAuthentication || (kind == kindUnknown && e.StatusCode == http.StatusUnauthorized)
+	}
+	return false
+}
+
+// HTTPStatusCode returns the HTTP status of the failed response, or 0
+func (e *Error) HTTPStatusCode() int { return e.StatusCode }
+
+// ErrorType returns the error type reported by the API
+func (e *Error) ErrorType() string { return e.Type }
+
+// ErrorCode returns the error code reported by the API
+func (e *Error) ErrorCode() string { return e.Code }
+
+// ServerRequestID returns the request ID assigned by the server, if known
+func (e *Error) ServerRequestID() string { return e.RequestID }
+
 // APIError represents a general API error
 type APIError struct {
 	Err *Error
 }
 
 func (e *APIError) Error() string { return e.Err.Error() }
+func (e *APIError) Unwrap() error { return e.Err }
 
 // APIStatusError represents an API status error
 type APIStatusError struct {
@@ -33,6 +133,7 @@ type APIStatusError struct {
 }
 
 func (e *APIStatusError) Error() string { return e.Err.Error() }
+func (e *APIStatusError) Unwrap() error { return e.Err }
 
 // APIRequestFailedError represents a 400 Bad Request error
 type APIRequestFailedError struct {
@@ -40,6 +141,7 @@ type APIRequestFailedError struct {
 }
 
 func (e *APIRequestFailedError) Error() string { return e.Err.Error() }
+func (e *APIRequestFailedError) Unwrap() error { return e.Err }
 
 // APIAuthenticationError represents a 401 Unauthorized error
 type APIAuthenticationError struct {
@@ -47,6 +149,7 @@ type APIAuthenticationError struct {
 }
 
 func (e *APIAuthenticationError) Error() string { return e.Err.Error() }
+func (e *APIAuthenticationError) Unwrap() error { return e.Err }
 
 // APIReachLimitError represents a 429 Rate Limit error
 type APIReachLimitError struct {
@@ -54,6 +157,7 @@ type APIReachLimitError struct {
 }
 
 func (e *APIReachLimitError) Error() string { return e.Err.Error() }
+func (e *APIReachLimitError) Unwrap() error { return e.Err }
 
 // APIInternalError represents a 500 Internal Server error
 type APIInternalError struct {
@@ -61,6 +165,7 @@ type APIInternalError struct {
 }
 
 func (e *APIInternalError) Error() string { return e.Err.Error() }
+func (e *APIInternalError) Unwrap() error { return e.Err }
 
 // APIServerFlowExceedError represents a 503 Service Unavailable error
 type APIServerFlowExceedError struct {
@@ -68,6 +173,42 @@ type APIServerFlowExceedError struct {
 }
 
 func (e *APIServerFlowExceedError) Error() string { return e.Err.Error() }
+func (e *APIServerFlowExceedError) Unwrap() error { return e.Err }
+
+// InsufficientBalanceError represents a request rejected because the account
+// balance is used up (code 1113)
+type InsufficientBalanceError struct {
+	Err *Error
+}
+
+func (e *InsufficientBalanceError) Error() string { return e.Err.Error() }
+func (e *InsufficientBalanceError) Unwrap() error { return e.Err }
+
+// QuotaExceededError represents a request rejected because a daily or
+// periodic usage limit is reached (codes 1304, 1308, 1310)
+type QuotaExceededError struct {
+	Err *Error
+}
+
+func (e *QuotaExceededError) Error() string { return e.Err.Error() }
+func (e *QuotaExceededError) Unwrap() error { return e.Err }
+
+// ContentFilterError represents input or output blocked by content moderation (code 1301)
+type ContentFilterError struct {
+	Err *Error
+}
+
+func (e *ContentFilterError) Error() string { return e.Err.Error() }
+func (e *ContentFilterError) Unwrap() error { return e.Err }
+
+// ContextLengthExceededError represents a prompt longer than the model
+// context allows (code 1261)
+type ContextLengthExceededError struct {
+	Err *Error
+}
+
+func (e *ContextLengthExceededError) Error() string { return e.Err.Error() }
+func (e *ContextLengthExceededError) Unwrap() error { return e.Err }
 
 // APITimeoutError represents a timeout error
 type APITimeoutError struct {
@@ -75,8 +216,19 @@ type APITimeoutError struct {
 }
 
 func (e *APITimeoutError) Error() string { return e.Err.Error() }
+func (e *APITimeoutError) Unwrap() error { return e.Err }
 
-// NewError creates a new Error based on HTTP status code
+// APIConnectionError represents a failure to reach the API, such as a DNS,
+// TLS or connection reset error
+type APIConnectionError struct {
+	Err *Error
+}
+
+func (e *APIConnectionError) Error() string { return e.Err.Error() }
+func (e *APIConnectionError) Unwrap() error { return e.Err }
+
+// NewError creates a new Error based on the business error code, falling
+// back to the HTTP status code
 func NewError(statusCode int, message, errType, code string) error {
 	baseErr := &Error{
 		Message:    message,
@@ -85,6 +237,21 @@ func NewError(statusCode int, message, errType, code string) error {
 		Code:       code,
 	}
 
+	switch businessCodes[code] {
+	case kindAuthentication:
+		return &APIAuthenticationError{Err: baseErr}
+	case kindInsufficientBalance:
+		return &InsufficientBalanceError{Err: baseErr}
+	case kindQuotaExceeded:
+		return &QuotaExceededError{Err: baseErr}
+	case kindContextLength:
+		return &ContextLengthExceededError{Err: baseErr}
+	case kindContentFilter:
+		return &ContentFilterError{Err: baseErr}
+	case kindRateLimit:
+		return &APIReachLimitError{Err: baseErr}
+	}
+
 	switch statusCode {
 	case http.StatusBadRequest:
 		return &APIRequestFailedError{Err: baseErr}
@@ -100,3 +267,97 @@ func NewError(statusCode int, message, errType, code string) error {
 		return &APIStatusError{Err: baseErr}
 	}
 }
+
+// ErrorKind returns a short name for the kind of err, such as
+// "APIReachLimitError" for the typed errors of this package, "canceled" or
+// "deadline_exceeded" for context errors, and "_OTHER" for anything else.
+func ErrorKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	}
+
+	t := reflect.TypeOf(err)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == reflect.TypeOf(Error{}).PkgPath() {
+		return t.Name()
+	}
+	return "_OTHER"
+}
+
+// newTransportError classifies an error returned by http.Client.Do as either
+// a timeout or a connection error
+func newTransportError(err error) error {
+	baseErr := &Error{
+		Message: fmt.Sprintf("request failed: %v", err),
+		cause:   err,
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &APITimeoutError{Err: baseErr}
+	}
+	return &APIConnectionError{Err: baseErr}
+}
+
+// errorResponse is the error envelope returned by the API, both as an HTTP
+// error body and as an event inside a stream
+type errorResponse struct {
+	Error *errorBody `json:"error"`
+}
+
+// errorBody is the error object inside an errorResponse
+type errorBody struct {
+	Message string    `json:"message"`
+	Type    string    `json:"type"`
+	Code    errorCode `json:"code"`
+}
+
+// toError converts the error object into a typed error. When the HTTP status
+// does not describe the failure, as for errors sent inside a successful
+// stream, the status is inferred from the error type.
+func (b *errorBody) toError(statusCode int) error {
+	if statusCode < http.StatusBadRequest {
+		if status, ok := errorTypeStatus[b.Type]; ok {
+			statusCode = status
+		}
+	}
+	return NewError(statusCode, b.Message, b.Type, string(b.Code))
+}
+
+// errorTypeStatus maps error types to the HTTP status they are normally sent with
+var errorTypeStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"rate_limit_exceeded":   http.StatusTooManyRequests,
+	"server_error":          http.StatusInternalServerError,
+	"internal_error":        http.StatusInternalServerError,
+	"overloaded_error":      http.StatusServiceUnavailable,
+}
+
+// errorCode is an error code that may be encoded as a JSON string or number
+type errorCode string
+
+func (c *errorCode) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*c = errorCode(s)
+		return nil
+	}
+	*c = errorCode(data)
+	return nil
+}
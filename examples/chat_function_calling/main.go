@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/yonwoo9/zai-go-sdk"
+)
+
+func main() {
+	// Create client
+	client, err := zai.NewClient("your-api-key")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tools := []zai.Tool{
+		zai.NewFunctionTool("get_weather", "Get the current weather for a city", map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{
+					"type":        "string",
+					"description": "The city name",
+				},
+			},
+			"required": []string{"city"},
+		}),
+	}
+
+	messages := []zai.Message{
+		zai.NewUserMessage("What's the weather like in Beijing?"),
+	}
+
+	// First turn: the model asks for a tool call
+	response, err := client.Chat.CreateChatCompletion(ctx, &zai.ChatCompletionRequest{
+		Model:    "glm-4.7",
+		Messages: messages,
+		Tools:    tools,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	choice := response.Choices[0]
+	if choice.FinishReason != "tool_calls" {
+		fmt.Println(*choice.Message.Content)
+		return
+	}
+
+	// Append the assistant turn and a result for every tool call
+	messages = append(messages, choice.Message.ToMessage())
+	for _, call := range choice.Message.ToolCalls {
+		fmt.Printf("Calling %s(%s)\n", call.Function.Name, call.Function.Arguments)
+		messages = append(messages, zai.NewToolResultMessage(call.ID, `{"city":"Beijing","weather":"sunny","temperature":25}`))
+	}
+
+	// Second turn: the model answers using the tool results
+	response, err = client.Chat.CreateChatCompletion(ctx, &zai.ChatCompletionRequest{
+		Model:    "glm-4.7",
+		Messages: messages,
+		Tools:    tools,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(*response.Choices[0].Message.Content)
+}
@@ -34,6 +34,9 @@ func main() {
 		case *zai.APITimeoutError:
 			fmt.Printf("Request timeout: %v\n", e)
 			fmt.Println("Please try again later.")
+		case *zai.APIConnectionError:
+			fmt.Printf("Connection failed: %v\n", e)
+			fmt.Println("Please check your network connection.")
 		case *zai.APIRequestFailedError:
 			fmt.Printf("Invalid request: %v\n", e)
 			fmt.Println("Please check your request parameters.")
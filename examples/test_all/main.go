@@ -1,6 +1,6 @@
 // test_all 通过环境变量 ZAI_API_KEY 测试所有已实现的 API 接口。
 // 在项目根目录运行: ZAI_API_KEY=your-key go run ./examples/test_all
-// 注: Embeddings/图像 可能因账号余额或资源包返回 429(code 1113)，属业务限制非 SDK 错误。
+// 注: Embeddings/图像 可能因账号余额或资源包返回 InsufficientBalanceError(429, code 1113)，属业务限制非 SDK 错误。
 package main
 
 import (
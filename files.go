@@ -0,0 +1,172 @@
+package zai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+)
+
+// FilesService handles file operations
+type FilesService struct {
+	client *BaseClient
+}
+
+// FileObject represents an uploaded file
+type FileObject struct {
+	ID            string  `json:"id"`
+	Object        string  `json:"object"`
+	Bytes         int64   `json:"bytes"`
+	CreatedAt     int64   `json:"created_at"`
+	Filename      string  `json:"filename"`
+	Purpose       string  `json:"purpose"`
+	Status        *string `json:"status,omitempty"`
+	StatusDetails *string `json:"status_details,omitempty"`
+}
+
+// FileList represents a page of files
+type FileList struct {
+	Object  string       `json:"object"`
+	Data    []FileObject `json:"data"`
+	HasMore bool         `json:"has_more"`
+}
+
+// FileDeleted represents the file deletion response
+type FileDeleted struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+// FileUploadRequest represents a file upload request
+type FileUploadRequest struct {
+	File     io.Reader // File content
+	Filename string    // Name of the file as stored on the platform; defaults to the base name of an *os.File
+	Purpose  string    // "batch", "retrieval", "fine-tune", "file-extract", ...
+}
+
+// FileListRequest represents the pagination and filter options for listing files
+type FileListRequest struct {
+	Purpose *string
+	Limit   *int
+	After   *string // Cursor: the ID of the last file in the previous page
+	Order   *string // "created_at"
+}
+
+// Upload uploads a file for use with retrieval, batch or fine-tuning
+func (s *FilesService) Upload(ctx context.Context, req *FileUploadRequest, opts ...CallOption) (*FileObject, error) {
+	if req.File == nil {
+		return nil, &Error{Message: "file must be provided"}
+	}
+	if req.Purpose == "" {
+		return nil, &Error{Message: "purpose must be provided"}
+	}
+
+	filename := req.Filename
+	if f, ok := req.File.(interface{ Name() string }); ok && filename == "" {
+		filename = filepath.Base(f.Name())
+	}
+	if filename == "" {
+		return nil, &Error{Message: "filename must be provided"}
+	}
+
+	body, err := newMultipartBody(map[string]string{"purpose": req.Purpose}, "file", filename, req.File)
+	if err != nil {
+		return nil, err
+	}
+
+	var result FileObject
+	err = s.client.doRequest(ctx, http.MethodPost, "/files", body, &result, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// List lists uploaded files
+func (s *FilesService) List(ctx context.Context, req *FileListRequest, opts ...CallOption) (*FileList, error) {
+	path := "/files"
+	if req != nil {
+		query := url.Values{}
+		if req.Purpose != nil {
+			query.Set("purpose", *req.Purpose)
+		}
+		if req.Limit != nil {
+			query.Set("limit", strconv.Itoa(*req.Limit))
+		}
+		if req.After != nil {
+			query.Set("after", *req.After)
+		}
+		if req.Order != nil {
+			query.Set("order", *req.Order)
+		}
+		if len(query) > 0 {
+			path += "?" + query.Encode()
+		}
+	}
+
+	var result FileList
+	err := s.client.doRequest(ctx, http.MethodGet, path, nil, &result, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Retrieve retrieves a file by ID
+func (s *FilesService) Retrieve(ctx context.Context, id string, opts ...CallOption) (*FileObject, error) {
+	if id == "" {
+		return nil, &Error{Message: "id must be provided"}
+	}
+
+	var result FileObject
+	err := s.client.doRequest(ctx, http.MethodGet, fmt.Sprintf("/files/%s", url.PathEscape(id)), nil, &result, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Delete deletes a file by ID
+func (s *FilesService) Delete(ctx context.Context, id string, opts ...CallOption) (*FileDeleted, error) {
+	if id == "" {
+		return nil, &Error{Message: "id must be provided"}
+	}
+
+	var result FileDeleted
+	err := s.client.doRequest(ctx, http.MethodDelete, fmt.Sprintf("/files/%s", url.PathEscape(id)), nil, &result, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Content downloads the content of a file. The caller must close the returned reader.
+func (s *FilesService) Content(ctx context.Context, id string, opts ...CallOption) (io.ReadCloser, error) {
+	if id == "" {
+		return nil, &Error{Message: "id must be provided"}
+	}
+
+	resp, err := s.client.doRawRequest(ctx, http.MethodGet, fmt.Sprintf("/files/%s/content", url.PathEscape(id)), nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBinaryResponse(resp), nil
+}
+
+// Helper function to create a file upload request
+func NewFileUploadRequest(file io.Reader, filename, purpose string) *FileUploadRequest {
+	return &FileUploadRequest{
+		File:     file,
+		Filename: filename,
+		Purpose:  purpose,
+	}
+}
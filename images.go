@@ -61,9 +61,9 @@ type AsyncImageGenerationRequest struct {
 }
 
 // Generations generates images from text prompts
-func (s *ImagesService) Generations(ctx context.Context, req *ImageGenerationRequest) (*ImagesResponse, error) {
+func (s *ImagesService) Generations(ctx context.Context, req *ImageGenerationRequest, opts ...CallOption) (*ImagesResponse, error) {
 	var result ImagesResponse
-	err := s.client.doRequest(ctx, http.MethodPost, "/images/generations", req, &result)
+	err := s.client.doRequest(ctx, http.MethodPost, "/images/generations", req, &result, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -73,9 +73,9 @@ func (s *ImagesService) Generations(ctx context.Context, req *ImageGenerationReq
 
 // AsyncGenerations asynchronously generates images from text prompts
 // Only supports glm-image model. Use RetrieveImagesResult() to poll for the result.
-func (s *ImagesService) AsyncGenerations(ctx context.Context, req *AsyncImageGenerationRequest) (*AsyncImagesResponse, error) {
+func (s *ImagesService) AsyncGenerations(ctx context.Context, req *AsyncImageGenerationRequest, opts ...CallOption) (*AsyncImagesResponse, error) {
 	var result AsyncImagesResponse
-	err := s.client.doRequest(ctx, http.MethodPost, "/async/images/generations", req, &result)
+	err := s.client.doRequest(ctx, http.MethodPost, "/async/images/generations", req, &result, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -84,13 +84,13 @@ func (s *ImagesService) AsyncGenerations(ctx context.Context, req *AsyncImageGen
 }
 
 // RetrieveImagesResult retrieves the result of an async image generation operation
-func (s *ImagesService) RetrieveImagesResult(ctx context.Context, id string) (*AsyncImagesResponse, error) {
+func (s *ImagesService) RetrieveImagesResult(ctx context.Context, id string, opts ...CallOption) (*AsyncImagesResponse, error) {
 	if id == "" {
 		return nil, &Error{Message: "id must be provided"}
 	}
 
 	var result AsyncImagesResponse
-	err := s.client.doRequest(ctx, http.MethodGet, fmt.Sprintf("/async-result/%s", id), nil, &result)
+	err := s.client.doRequest(ctx, http.MethodGet, fmt.Sprintf("/async-result/%s", id), nil, &result, opts...)
 	if err != nil {
 		return nil, err
 	}
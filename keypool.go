@@ -0,0 +1,238 @@
+package zai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyPoolStrategy selects which available key a KeyPool hands out next
+type KeyPoolStrategy int
+
+const (
+	// KeyPoolRoundRobin cycles through the available keys in order
+	KeyPoolRoundRobin KeyPoolStrategy = iota
+	// KeyPoolLeastRecentlyLimited prefers the key that was rate limited
+	// longest ago, or never
+	KeyPoolLeastRecentlyLimited
+)
+
+const (
+	// DefaultRateLimitQuarantine is how long a rate-limited key is skipped by default
+	DefaultRateLimitQuarantine = time.Minute
+	// DefaultQuotaQuarantine is how long a key with an exhausted balance or
+	// quota is skipped by default
+	DefaultQuotaQuarantine = time.Hour
+)
+
+// KeyPoolConfig holds the configuration for a KeyPool
+type KeyPoolConfig struct {
+	Strategy KeyPoolStrategy
+	// RateLimitQuarantine is how long a key is skipped after a rate limit
+	// error, or longer if the server asks for it with Retry-After
+	RateLimitQuarantine time.Duration
+	// QuotaQuarantine is how long a key is skipped after an insufficient
+	// balance or quota exceeded error
+	QuotaQuarantine time.Duration
+}
+
+// KeyStats reports the state and usage of a key in a KeyPool
+type KeyStats struct {
+	KeyID            string    // The id part of an "id.secret" key, or a masked key
+	Requests         int64     // Requests made with the key
+	Failures         int64     // Requests rejected by the API
+	RateLimited      int64     // Rate limit errors
+	QuotaExhausted   int64     // Insufficient balance and quota exceeded errors
+	Disabled         bool      // Permanently disabled after an authentication error
+	QuarantinedUntil time.Time // Zero when the key is not quarantined
+	LastLimitedAt    time.Time // Time of the last rate limit or quota error
+	LastError        error     // Last error returned for the key
+}
+
+// KeyPool is a CredentialsProvider that spreads requests over several API
+// keys. A key is quarantined for a while after a rate limit or quota error
+// and disabled for good after an authentication error; the request is then
+// retried right away with another key. When every enabled key is
+// quarantined, the one whose quarantine ends first is used.
+type KeyPool struct {
+	config KeyPoolConfig
+
+	mu   sync.Mutex
+	keys []*poolKey
+	next int
+}
+
+// poolKey is a key in a KeyPool and its state
+type poolKey struct {
+	key   string
+	stats KeyStats
+}
+
+// NewKeyPool creates a key pool with the given keys
+func NewKeyPool(keys []string, config ...*KeyPoolConfig) *KeyPool {
+	var cfg KeyPoolConfig
+	if len(config) > 0 && config[0] != nil {
+		cfg = *config[0]
+	}
+	if cfg.RateLimitQuarantine <= 0 {
+		cfg.RateLimitQuarantine = DefaultRateLimitQuarantine
+	}
+	if cfg.QuotaQuarantine <= 0 {
+		cfg.QuotaQuarantine = DefaultQuotaQuarantine
+	}
+
+	pool := &KeyPool{config: cfg}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		pool.keys = append(pool.keys, &poolKey{
+			key:   key,
+			stats: KeyStats{KeyID: keyID(key)},
+		})
+	}
+	return pool
+}
+
+// APIKey returns the next key to use
+func (p *KeyPool) APIKey(ctx context.Context) (string, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var chosen, fallback *poolKey
+	for i := range p.keys {
+		k := p.keys[(p.next+i)%len(p.keys)]
+		if k.stats.Disabled {
+			continue
+		}
+		if now.Before(k.stats.QuarantinedUntil) {
+			if fallback == nil || k.stats.QuarantinedUntil.Before(fallback.stats.QuarantinedUntil) {
+				fallback = k
+			}
+			continue
+		}
+		if chosen == nil {
+			chosen = k
+			if p.config.Strategy == KeyPoolRoundRobin {
+				break
+			}
+		} else if k.stats.LastLimitedAt.Before(chosen.stats.LastLimitedAt) {
+			chosen = k
+		}
+	}
+
+	if chosen == nil {
+		chosen = fallback
+	}
+	if chosen == nil {
+		return "", &Error{Message: "no usable API key in pool"}
+	}
+
+	for i, k := range p.keys {
+		if k == chosen {
+			p.next = (i + 1) % len(p.keys)
+			break
+		}
+	}
+	chosen.stats.Requests++
+	return chosen.key, nil
+}
+
+// Invalidate permanently disables a key the API rejected as invalid
+func (p *KeyPool) Invalidate(apiKey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k := p.find(apiKey); k != nil {
+		k.stats.Disabled = true
+	}
+}
+
+// ReportResult records the outcome of a request and quarantines or disables
+// the key depending on the error. It reports whether another key is
+// available to retry with.
+func (p *KeyPool) ReportResult(apiKey string, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := p.find(apiKey)
+	if k == nil {
+		return false
+	}
+	k.stats.Failures++
+	k.stats.LastError = err
+
+	switch {
+	case errors.Is(err, ErrAuthentication):
+		k.stats.Disabled = true
+	case errors.Is(err, ErrQuotaExhausted):
+		k.stats.QuotaExhausted++
+		k.stats.LastLimitedAt = now
+		k.stats.QuarantinedUntil = now.Add(p.config.QuotaQuarantine)
+	case errors.Is(err, ErrRateLimited):
+		quarantine := p.config.RateLimitQuarantine
+		if apiErr := baseError(err); apiErr != nil && apiErr.RetryAfter > quarantine {
+			quarantine = apiErr.RetryAfter
+		}
+		k.stats.RateLimited++
+		k.stats.LastLimitedAt = now
+		k.stats.QuarantinedUntil = now.Add(quarantine)
+	default:
+		return false
+	}
+
+	return p.hasAvailable(now)
+}
+
+// Stats returns a snapshot of the state of every key in the pool
+func (p *KeyPool) Stats() []KeyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]KeyStats, len(p.keys))
+	for i, k := range p.keys {
+		stats[i] = k.stats
+	}
+	return stats
+}
+
+// find returns the pool entry for apiKey, or nil
+func (p *KeyPool) find(apiKey string) *poolKey {
+	for _, k := range p.keys {
+		if k.key == apiKey {
+			return k
+		}
+	}
+	return nil
+}
+
+// hasAvailable reports whether any key is neither disabled nor quarantined
+func (p *KeyPool) hasAvailable(now time.Time) bool {
+	for _, k := range p.keys {
+		if !k.stats.Disabled && !now.Before(k.stats.QuarantinedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// keyID returns a representation of key that is safe to log
+func keyID(key string) string {
+	if id, _, ok := strings.Cut(key, "."); ok && id != "" {
+		return id
+	}
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,194 @@
+package zai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxLoggedBody caps the length of a body written to the log
+	maxLoggedBody = 16 << 10
+	// maxLoggedBase64 is how much of a base64 payload, such as an inline
+	// image, is kept in a logged body
+	maxLoggedBase64 = 32
+)
+
+// base64Payload matches data URIs and long base64 JSON strings
+var base64Payload = regexp.MustCompile(`data:[\w.+-]+/[\w.+-]+;base64,[A-Za-z0-9+/=]{` + fmt.Sprint(maxLoggedBase64) + `,}|"[A-Za-z0-9+/]{256,}={0,2}"`)
+
+// logStart logs the start of a call
+func (s *callState) logStart() {
+	s.log(slog.LevelDebug, "zai request started",
+		slog.Bool("stream", s.info.Stream))
+}
+
+// logAttempt logs the outcome of an attempt that started at start
+func (s *callState) logAttempt(attempt int, start time.Time, err error) {
+	attrs := []slog.Attr{
+		slog.Int("attempt", attempt),
+		slog.Int("status", statusCode(err)),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	s.log(slog.LevelDebug, "zai attempt finished", attrs...)
+}
+
+// logRetry logs a retry that is about to happen
+func (s *callState) logRetry(attempt RetryAttempt) {
+	s.log(slog.LevelWarn, "zai request retrying",
+		slog.Int("retry", attempt.Attempt),
+		slog.Duration("delay", attempt.Delay),
+		slog.String("error_kind", ErrorKind(attempt.Err)),
+		slog.String("error", attempt.Err.Error()))
+}
+
+// logFinish logs the outcome of a call. Successful calls are logged at info
+// level, canceled ones at warn level and failed ones at error level.
+func (s *callState) logFinish(m *CallMetrics) {
+	attrs := []slog.Attr{
+		slog.Int("status", m.StatusCode),
+		slog.Duration("duration", m.Duration),
+		slog.Int("attempts", m.Attempts),
+	}
+	if m.TimeToFirstChunk > 0 {
+		attrs = append(attrs, slog.Duration("time_to_first_chunk", m.TimeToFirstChunk))
+	}
+	if m.Usage != nil && m.Usage.TotalTokens > 0 {
+		attrs = append(attrs,
+			slog.Int("prompt_tokens", m.Usage.PromptTokens),
+			slog.Int("completion_tokens", m.Usage.CompletionTokens))
+	}
+
+	if m.Err == nil {
+		s.log(slog.LevelInfo, "zai request finished", attrs...)
+		return
+	}
+
+	attrs = append(attrs, slog.String("error_kind", m.ErrorKind), slog.String("error", m.Err.Error()))
+	if apiErr := baseError(m.Err); apiErr != nil && apiErr.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", apiErr.RequestID))
+	}
+	level := slog.LevelError
+	if m.ErrorKind == "canceled" || m.ErrorKind == "deadline_exceeded" {
+		level = slog.LevelWarn
+	}
+	s.log(level, "zai request failed", attrs...)
+}
+
+// log writes a record about the call, if a logger is configured
+func (s *callState) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if s.logger == nil || !s.logger.Enabled(s.ctx, level) {
+		return
+	}
+
+	attrs = append([]slog.Attr{
+		slog.String("method", s.method),
+		slog.String("path", s.info.Path),
+		slog.String("model", s.info.Model),
+	}, attrs...)
+	s.logger.LogAttrs(s.ctx, level, msg, attrs...)
+}
+
+// logRequestBody logs the headers and body of a request at debug level when
+// body logging is enabled. The Authorization header and apiKey are redacted.
+func (c *BaseClient) logRequestBody(req *http.Request, body interface{}, data []byte, apiKey string) {
+	if !c.logBodies || c.logger == nil || !c.logger.Enabled(req.Context(), slog.LevelDebug) {
+		return
+	}
+
+	logged := redactBody(data, apiKey)
+	if mp, ok := body.(*multipartBody); ok {
+		logged = fmt.Sprintf("<%s, %d bytes>", mp.contentType, len(mp.data))
+	}
+	c.logger.LogAttrs(req.Context(), slog.LevelDebug, "zai request body",
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.String()),
+		slog.Any("headers", redactHeaders(req.Header, apiKey)),
+		slog.String("body", logged))
+}
+
+// logResponseBody logs the headers and body of a response at debug level when
+// body logging is enabled. The body is read and replaced so it can still be
+// consumed by the caller. Streamed and binary bodies are not logged.
+func (c *BaseClient) logResponseBody(ctx context.Context, resp *http.Response, apiKey string) {
+	if !c.logBodies || c.logger == nil || !c.logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if resp.StatusCode < 400 && !strings.Contains(contentType, "json") {
+		return
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), errReader{err}))
+
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "zai response body",
+		slog.Int("status", resp.StatusCode),
+		slog.Any("headers", redactHeaders(resp.Header, apiKey)),
+		slog.String("body", redactBody(data, apiKey)))
+}
+
+// redactHeaders returns a copy of header safe to log
+func redactHeaders(header http.Header, apiKey string) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for key, values := range header {
+		value := strings.Join(values, ", ")
+		switch {
+		case strings.EqualFold(key, "Authorization"):
+			value = "[REDACTED]"
+		case apiKey != "" && strings.Contains(value, apiKey):
+			value = strings.ReplaceAll(value, apiKey, keyID(apiKey))
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+// redactBody returns body safe to log: apiKey is masked, base64 payloads are
+// truncated and the result is capped at maxLoggedBody
+func redactBody(body []byte, apiKey string) string {
+	s := string(body)
+	if apiKey != "" {
+		s = strings.ReplaceAll(s, apiKey, keyID(apiKey))
+	}
+	s = base64Payload.ReplaceAllStringFunc(s, func(payload string) string {
+		quoted := strings.HasPrefix(payload, `"`)
+		payload = strings.Trim(payload, `"`)
+		prefix := payload
+		if i := strings.Index(payload, ";base64,"); i >= 0 {
+			prefix = payload[:i+len(";base64,")]
+			payload = payload[len(prefix):]
+		} else {
+			prefix = ""
+		}
+		truncated := fmt.Sprintf("%s%s...[%d bytes]", prefix, payload[:maxLoggedBase64], len(payload))
+		if quoted {
+			return `"` + truncated + `"`
+		}
+		return truncated
+	})
+	if len(s) > maxLoggedBody {
+		s = fmt.Sprintf("%s...[%d bytes]", s[:maxLoggedBody], len(s))
+	}
+	return s
+}
+
+// errReader returns err once the replaced body is read to its end
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
@@ -0,0 +1,255 @@
+package zai
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsRecorder receives measurements of the API calls made by a client.
+// Implementations must be safe for concurrent use and should return quickly,
+// since they are called on the request path.
+type MetricsRecorder interface {
+	// RecordCall is called once per call, when the response is decoded or,
+	// for streams, when the stream ends or is closed
+	RecordCall(m CallMetrics)
+	// RecordRetry is called before every retry
+	RecordRetry(m RetryMetrics)
+}
+
+// CallMetrics describes a finished API call
+type CallMetrics struct {
+	Operation        string           // "chat", "embeddings", or the endpoint path joined with dots
+	Model            string           // Model of the request, if any
+	Path             string           // Endpoint path relative to the base URL
+	Stream           bool             // The response was streamed
+	Attempts         int              // Attempts made, 1 when the call was not retried
+	Duration         time.Duration    // Until the response was decoded or the stream ended
+	TimeToFirstChunk time.Duration    // Until the first chunk of a stream, 0 otherwise
+	StatusCode       int              // HTTP status of the last attempt, 0 if there was no response
+	FinishReasons    []string         // Finish reasons of the choices, if any
+	Usage            *CompletionUsage // Token usage reported by the API, if any
+	Err              error            // Error the call failed with, nil on success
+	ErrorKind        string           // ErrorKind(Err)
+}
+
+// RetryMetrics describes a retry that is about to happen
+type RetryMetrics struct {
+	Operation string
+	Model     string
+	Path      string
+	Attempt   int    // 1 for the first retry
+	ErrorKind string // ErrorKind of the failed attempt
+}
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the latency
+// histograms kept by MetricsCollector
+var DefaultLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+// MetricsCollector is a MetricsRecorder that aggregates calls per operation
+// and model, and exposes them in the Prometheus text format. It can be
+// mounted as an http.Handler or its output merged into an existing endpoint
+// with WritePrometheus.
+//
+// The following metrics are kept:
+//
+//	zai_requests_total{operation,model,status_code}
+//	zai_request_errors_total{operation,model,error_kind}
+//	zai_request_retries_total{operation,model}
+//	zai_request_duration_seconds{operation,model}       (histogram)
+//	zai_time_to_first_chunk_seconds{operation,model}    (histogram)
+//	zai_tokens_total{operation,model,type}              (prompt, completion, cached, reasoning)
+type MetricsCollector struct {
+	buckets []float64
+
+	mu               sync.Mutex
+	requests         map[seriesKey]int64
+	errors           map[seriesKey]int64
+	retries          map[seriesKey]int64
+	tokens           map[seriesKey]int64
+	duration         map[seriesKey]*histogram
+	timeToFirstChunk map[seriesKey]*histogram
+}
+
+// seriesKey identifies a series; label is the value of the metric specific
+// label, such as the status code or error type
+type seriesKey struct {
+	operation string
+	model     string
+	label     string
+}
+
+// histogram is a cumulative histogram with fixed buckets
+type histogram struct {
+	counts []int64 // counts[i] is the number of observations <= buckets[i]
+	count  int64
+	sum    float64
+}
+
+// NewMetricsCollector creates a collector. buckets, if given, replace
+// DefaultLatencyBuckets as the latency histogram bounds in seconds.
+func NewMetricsCollector(buckets ...float64) *MetricsCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &MetricsCollector{
+		buckets:          buckets,
+		requests:         make(map[seriesKey]int64),
+		errors:           make(map[seriesKey]int64),
+		retries:          make(map[seriesKey]int64),
+		tokens:           make(map[seriesKey]int64),
+		duration:         make(map[seriesKey]*histogram),
+		timeToFirstChunk: make(map[seriesKey]*histogram),
+	}
+}
+
+// RecordCall adds a finished call to the metrics
+func (c *MetricsCollector) RecordCall(m CallMetrics) {
+	key := seriesKey{operation: m.Operation, model: m.Model}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[seriesKey{m.Operation, m.Model, strconv.Itoa(m.StatusCode)}]++
+	if m.ErrorKind != "" {
+		c.errors[seriesKey{m.Operation, m.Model, m.ErrorKind}]++
+	}
+	c.observe(c.duration, key, m.Duration)
+	if m.TimeToFirstChunk > 0 {
+		c.observe(c.timeToFirstChunk, key, m.TimeToFirstChunk)
+	}
+
+	if u := m.Usage; u != nil {
+		c.tokens[seriesKey{m.Operation, m.Model, "prompt"}] += int64(u.PromptTokens)
+		c.tokens[seriesKey{m.Operation, m.Model, "completion"}] += int64(u.CompletionTokens)
+		if u.PromptTokensDetails != nil {
+			c.tokens[seriesKey{m.Operation, m.Model, "cached"}] += int64(u.PromptTokensDetails.CachedTokens)
+		}
+		if u.CompletionTokensDetails != nil {
+			c.tokens[seriesKey{m.Operation, m.Model, "reasoning"}] += int64(u.CompletionTokensDetails.ReasoningTokens)
+		}
+	}
+}
+
+// RecordRetry counts a retry
+func (c *MetricsCollector) RecordRetry(m RetryMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.retries[seriesKey{operation: m.Operation, model: m.Model}]++
+}
+
+// observe adds d to the histogram of key in h. c.mu must be held.
+func (c *MetricsCollector) observe(h map[seriesKey]*histogram, key seriesKey, d time.Duration) {
+	hist := h[key]
+	if hist == nil {
+		hist = &histogram{counts: make([]int64, len(c.buckets))}
+		h[key] = hist
+	}
+
+	seconds := d.Seconds()
+	for i, bound := range c.buckets {
+		if seconds <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += seconds
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+func (c *MetricsCollector) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	c.mu.Lock()
+	writeCounter(bw, "zai_requests_total", "API calls by final HTTP status code, 0 when no response was received.", "status_code", c.requests)
+	writeCounter(bw, "zai_request_errors_total", "Failed API calls by error kind.", "error_kind", c.errors)
+	writeCounter(bw, "zai_request_retries_total", "Retried attempts of API calls.", "", c.retries)
+	writeHistogram(bw, "zai_request_duration_seconds", "Duration of API calls, until the response is decoded or the stream ends.", c.buckets, c.duration)
+	writeHistogram(bw, "zai_time_to_first_chunk_seconds", "Time from the start of a streaming call to its first chunk.", c.buckets, c.timeToFirstChunk)
+	writeCounter(bw, "zai_tokens_total", "Tokens reported by the API by type: prompt, completion, cached or reasoning.", "type", c.tokens)
+	c.mu.Unlock()
+
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format
+func (c *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WritePrometheus(w)
+}
+
+// writeCounter writes a counter family. labelName is the name of the series
+// specific label, or empty if there is none.
+func writeCounter(w *bufio.Writer, name, help, labelName string, series map[seriesKey]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(series) {
+		fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(key, labelName, "", ""), series[key])
+	}
+}
+
+// writeHistogram writes a histogram family
+func writeHistogram(w *bufio.Writer, name, help string, buckets []float64, series map[seriesKey]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, key := range sortedKeys(series) {
+		hist := series[key]
+		for i, bound := range buckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(key, "", "le", le), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(key, "", "le", "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(key, "", "", ""), strconv.FormatFloat(hist.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(key, "", "", ""), hist.count)
+	}
+}
+
+// formatLabels formats the labels of a series, with an optional extra label
+func formatLabels(key seriesKey, labelName, extraName, extraValue string) string {
+	var sb strings.Builder
+	sb.WriteString(`{operation="`)
+	sb.WriteString(escapeLabel(key.operation))
+	sb.WriteString(`",model="`)
+	sb.WriteString(escapeLabel(key.model))
+	sb.WriteByte('"')
+	if labelName != "" {
+		fmt.Fprintf(&sb, `,%s="%s"`, labelName, escapeLabel(key.label))
+	}
+	if extraName != "" {
+		fmt.Fprintf(&sb, `,%s="%s"`, extraName, escapeLabel(extraValue))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// escapeLabel escapes a label value for the text exposition format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// sortedKeys returns the keys of a series map in a stable order
+func sortedKeys[V any](series map[seriesKey]V) []seriesKey {
+	keys := make([]seriesKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.operation != b.operation {
+			return a.operation < b.operation
+		}
+		if a.model != b.model {
+			return a.model < b.model
+		}
+		return a.label < b.label
+	})
+	return keys
+}
@@ -0,0 +1,113 @@
+package zai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// APICall describes an API call as seen by middleware
+type APICall struct {
+	Method    string
+	Path      string // Endpoint path relative to the base URL, e.g. "/chat/completions"
+	Operation string // "chat", "embeddings", or the endpoint path joined with dots
+	Model     string // Model of the request, if any
+	// Body is the typed request, such as *ChatCompletionRequest, or the
+	// encoded form for multipart uploads. It is nil for requests without a body.
+	Body interface{}
+	// Header holds extra headers sent with every attempt. Middleware may add
+	// or replace entries; they take precedence over the default headers.
+	Header http.Header
+	Stream bool // The response is a server-sent event stream
+	// BaseURL is the URL Path is appended to, the client's unless overridden
+	// with WithBaseURL
+	BaseURL string
+	// MaxRetries is the number of retries allowed after the first attempt
+	MaxRetries int
+	// ExtraFields are merged into the top level of a JSON body, replacing
+	// fields of the same name
+	ExtraFields map[string]interface{}
+
+	hooks *callHooks // Shared by copies of the call
+}
+
+// callHooks holds the functions registered on a call by middleware
+type callHooks struct {
+	attempt []AttemptHook
+	finish  []func(CallMetrics)
+}
+
+// AttemptHook is called before an attempt of a call, the first one being 0.
+// It may add headers to the request of the attempt, such as a trace context,
+// and returns the context the attempt runs with. The function it returns, if
+// not nil, is called with the outcome of the attempt: nil on success or the
+// error it failed with.
+type AttemptHook func(ctx context.Context, attempt int, header http.Header) (context.Context, func(err error))
+
+// OnAttempt registers fn to be called before every attempt of the call.
+// Middleware must register fn before calling next.
+func (c *APICall) OnAttempt(fn AttemptHook) {
+	if c.hooks == nil {
+		c.hooks = &callHooks{}
+	}
+	c.hooks.attempt = append(c.hooks.attempt, fn)
+}
+
+// OnFinish registers fn to be called once the call ends, with the same
+// measurements a MetricsRecorder receives. For streams this is when the
+// stream is read to its end, fails or is closed, so m.Err includes errors the
+// API sends inside the stream. Middleware must register fn before calling
+// next.
+func (c *APICall) OnFinish(fn func(m CallMetrics)) {
+	if c.hooks == nil {
+		c.hooks = &callHooks{}
+	}
+	c.hooks.finish = append(c.hooks.finish, fn)
+}
+
+// APIHandler performs an API call. The result is the decoded response, such
+// as *ChatCompletion, or for streaming and binary endpoints the
+// *http.Response with its body unread. A stream is only read after the
+// handler returns; use APICall.OnFinish to observe how it ends.
+type APIHandler func(ctx context.Context, call *APICall) (interface{}, error)
+
+// Middleware wraps an APIHandler to observe or alter API calls. The handler
+// passed to the outermost middleware includes retries, so a middleware runs
+// once per call however many attempts are made. A middleware may return a
+// different result as long as it has the same type as the one next returns.
+type Middleware func(next APIHandler) APIHandler
+
+// attemptHeaderKey is the context key of the headers added by attempt hooks
+type attemptHeaderKey struct{}
+
+// attemptHeader returns the headers attempt hooks added for the attempt ctx
+// belongs to
+func attemptHeader(ctx context.Context) http.Header {
+	header, _ := ctx.Value(attemptHeaderKey{}).(http.Header)
+	return header
+}
+
+// handle runs call through the configured middleware, ending with final
+func (c *BaseClient) handle(ctx context.Context, call *APICall, final APIHandler) (interface{}, error) {
+	h := final
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	return h(ctx, call)
+}
+
+// setResult copies out into result when a middleware replaced the decoded
+// response with another value of the same type
+func setResult(result, out interface{}) error {
+	if result == nil || out == nil || out == result {
+		return nil
+	}
+
+	dst, src := reflect.ValueOf(result), reflect.ValueOf(out)
+	if dst.Type() != src.Type() || dst.Kind() != reflect.Ptr || dst.IsNil() || src.IsNil() {
+		return &Error{Message: fmt.Sprintf("middleware returned %T, want %T", out, result)}
+	}
+	dst.Elem().Set(src.Elem())
+	return nil
+}
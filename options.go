@@ -0,0 +1,169 @@
+package zai
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CallOption customizes a single API call. Options are accepted by every
+// service method.
+type CallOption func(*callOptions)
+
+// callOptions holds the options of a call
+type callOptions struct {
+	metadata    *ResponseMetadata
+	timeout     time.Duration
+	baseURL     string
+	maxRetries  *int
+	header      http.Header
+	extraFields map[string]interface{}
+}
+
+// newCallOptions applies opts
+func newCallOptions(opts []CallOption) *callOptions {
+	o := &callOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// apply sets the options that are part of the call description
+func (o *callOptions) apply(call *APICall) {
+	if o.baseURL != "" {
+		call.BaseURL = strings.TrimRight(o.baseURL, "/")
+	}
+	if o.maxRetries != nil {
+		call.MaxRetries = *o.maxRetries
+	}
+	for key, values := range o.header {
+		call.Header[key] = values
+	}
+	call.ExtraFields = o.extraFields
+}
+
+// WithTimeout bounds the whole call, including retries and, for streams,
+// reading the stream
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithMaxRetries overrides ClientConfig.MaxRetries for the call. Zero
+// disables retries.
+func WithMaxRetries(maxRetries int) CallOption {
+	return func(o *callOptions) {
+		if maxRetries < 0 {
+			maxRetries = 0
+		}
+		o.maxRetries = &maxRetries
+	}
+}
+
+// WithHeader sets a request header for the call, replacing the default and
+// custom headers of the same name
+func WithHeader(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.header == nil {
+			o.header = http.Header{}
+		}
+		o.header.Set(key, value)
+	}
+}
+
+// WithBaseURL sends the call to another base URL, such as a regional
+// endpoint or a proxy
+func WithBaseURL(baseURL string) CallOption {
+	return func(o *callOptions) {
+		o.baseURL = baseURL
+	}
+}
+
+// WithExtraFields adds fields the SDK does not model yet to the top level of
+// the JSON request body. They replace fields of the same name and are ignored
+// for requests without a JSON body, such as file uploads.
+func WithExtraFields(fields map[string]interface{}) CallOption {
+	return func(o *callOptions) {
+		if o.extraFields == nil {
+			o.extraFields = make(map[string]interface{}, len(fields))
+		}
+		for key, value := range fields {
+			o.extraFields[key] = value
+		}
+	}
+}
+
+// WithRequestID sets the request_id field of the request body. The API uses
+// it to identify the request, and it stays the same across retries, so it
+// can serve as an idempotency key. Like WithExtraFields, it only applies to
+// JSON requests.
+func WithRequestID(requestID string) CallOption {
+	return WithExtraFields(map[string]interface{}{"request_id": requestID})
+}
+
+// WithResponseMetadata fills meta with the metadata of the response once the
+// call returns, whether it succeeded or not. For streaming calls it is filled
+// when the stream is returned, before the first chunk is read.
+func WithResponseMetadata(meta *ResponseMetadata) CallOption {
+	return func(o *callOptions) {
+		o.metadata = meta
+	}
+}
+
+// ResponseMetadata describes the HTTP response of an API call
+type ResponseMetadata struct {
+	StatusCode int           // Status of the last attempt, 0 if no response was received
+	Header     http.Header   // Headers of the last response
+	RequestID  string        // Request ID assigned by the server, if reported
+	RateLimit  RateLimitInfo // Rate limit state reported by the server, if any
+	Latency    time.Duration // From the start of the call to the response, including retries
+	Attempts   int           // Attempts made, 1 when the call was not retried
+	RawBody    []byte        // Undecoded JSON body; nil for streaming and binary responses
+}
+
+// RateLimitInfo is the rate limit state reported in the x-ratelimit-*
+// response headers. Fields the server did not send are zero.
+type RateLimitInfo struct {
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration
+}
+
+// parseRateLimitInfo reads the rate limit headers of a response
+func parseRateLimitInfo(header http.Header) RateLimitInfo {
+	return RateLimitInfo{
+		LimitRequests:     headerInt(header, "X-Ratelimit-Limit-Requests"),
+		RemainingRequests: headerInt(header, "X-Ratelimit-Remaining-Requests"),
+		ResetRequests:     headerDuration(header, "X-Ratelimit-Reset-Requests"),
+		LimitTokens:       headerInt(header, "X-Ratelimit-Limit-Tokens"),
+		RemainingTokens:   headerInt(header, "X-Ratelimit-Remaining-Tokens"),
+		ResetTokens:       headerDuration(header, "X-Ratelimit-Reset-Tokens"),
+	}
+}
+
+func headerInt(header http.Header, key string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(header.Get(key)))
+	return n
+}
+
+// headerDuration parses a duration given either in seconds or in Go
+// duration syntax such as "1m30s" or "250ms"
+func headerDuration(header http.Header, key string) time.Duration {
+	value := strings.TrimSpace(header.Get(key))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	d, _ := time.ParseDuration(value)
+	return d
+}
@@ -0,0 +1,22 @@
+module github.com/yonwoo9/zai-go-sdk/otelzai
+
+go 1.21
+
+require (
+	github.com/yonwoo9/zai-go-sdk v0.0.0-20261016201303-9c2df91b60a8
+	go.opentelemetry.io/otel v1.29.0
+	go.opentelemetry.io/otel/sdk v1.29.0
+	go.opentelemetry.io/otel/trace v1.29.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/otel/metric v1.29.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+)
+
+// Local builds use the SDK in the parent directory; dependents ignore this and
+// use the version required above
+replace github.com/yonwoo9/zai-go-sdk => ../
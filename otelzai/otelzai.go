@@ -0,0 +1,191 @@
+// Package otelzai traces the API calls of a zai client with OpenTelemetry.
+//
+// Install the middleware returned by Middleware on the client:
+//
+//	client, err := zai.NewClient("your-api-key", &zai.ClientConfig{
+//		Middleware: []zai.Middleware{otelzai.Middleware()},
+//	})
+//
+// Every call gets a span named after its operation and model, with a child
+// span for every attempt. Spans carry the GenAI semantic-convention
+// attributes; streaming spans end when the stream is closed or fully read.
+package otelzai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	zai "github.com/yonwoo9/zai-go-sdk"
+)
+
+// ScopeName is the instrumentation scope of the spans created by the middleware
+const ScopeName = "github.com/yonwoo9/zai-go-sdk/otelzai"
+
+// Span attributes, following the OpenTelemetry semantic conventions for
+// generative AI and HTTP clients where they exist
+const (
+	attrOperationName     = attribute.Key("gen_ai.operation.name")
+	attrSystem            = attribute.Key("gen_ai.system")
+	attrRequestModel      = attribute.Key("gen_ai.request.model")
+	attrResponseID        = attribute.Key("gen_ai.response.id")
+	attrResponseModel     = attribute.Key("gen_ai.response.model")
+	attrFinishReasons     = attribute.Key("gen_ai.response.finish_reasons")
+	attrInputTokens       = attribute.Key("gen_ai.usage.input_tokens")
+	attrOutputTokens      = attribute.Key("gen_ai.usage.output_tokens")
+	attrTimeToFirstToken  = attribute.Key("gen_ai.response.time_to_first_token")
+	attrErrorType         = attribute.Key("error.type")
+	attrHTTPMethod        = attribute.Key("http.request.method")
+	attrHTTPStatusCode    = attribute.Key("http.response.status_code")
+	attrHTTPResendCount   = attribute.Key("http.request.resend_count")
+	attrURLPath           = attribute.Key("url.path")
+	attrServerRequestID   = attribute.Key("zai.request_id")
+	attrStream            = attribute.Key("zai.stream")
+	attrRetryAttemptCount = attribute.Key("zai.attempts")
+)
+
+// config holds the settings of the middleware
+type config struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option customizes the middleware
+type Option func(*config)
+
+// WithTracerProvider sets the provider of the tracer. The global provider is
+// used by default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.provider = provider
+	}
+}
+
+// WithPropagator sets the propagator that adds the trace context to the
+// request headers. The global propagator is used by default.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagator = propagator
+	}
+}
+
+// Middleware returns a zai.Middleware that records every API call as a span,
+// with a child span for every attempt whose context is sent in the request
+// headers
+func Middleware(opts ...Option) zai.Middleware {
+	cfg := config{
+		provider:   otel.GetTracerProvider(),
+		propagator: otel.GetTextMapPropagator(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	tracer := cfg.provider.Tracer(ScopeName)
+
+	return func(next zai.APIHandler) zai.APIHandler {
+		return func(ctx context.Context, call *zai.APICall) (interface{}, error) {
+			name := call.Operation
+			if call.Model != "" {
+				name += " " + call.Model
+			}
+
+			attrs := []attribute.KeyValue{
+				attrOperationName.String(call.Operation),
+				attrSystem.String("zhipu"),
+				attrHTTPMethod.String(call.Method),
+				attrURLPath.String(call.Path),
+				attrStream.Bool(call.Stream),
+			}
+			if call.Model != "" {
+				attrs = append(attrs, attrRequestModel.String(call.Model))
+			}
+
+			start := time.Now()
+			ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+			call.OnAttempt(func(ctx context.Context, attempt int, header http.Header) (context.Context, func(error)) {
+				attrs := []attribute.KeyValue{attrHTTPMethod.String(call.Method)}
+				if attempt > 0 {
+					attrs = append(attrs, attrHTTPResendCount.Int(attempt))
+				}
+				ctx, span := tracer.Start(ctx, call.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+				cfg.propagator.Inject(ctx, propagation.HeaderCarrier(header))
+
+				return ctx, func(err error) {
+					if code := statusCode(err); code != 0 {
+						span.SetAttributes(attrHTTPStatusCode.Int(code))
+					}
+					recordError(span, err)
+					span.End()
+				}
+			})
+			call.OnFinish(func(m zai.CallMetrics) {
+				endCall(span, start, m)
+			})
+
+			result, err := next(ctx, call)
+
+			switch r := result.(type) {
+			case *zai.ChatCompletion:
+				span.SetAttributes(attrResponseID.String(r.ID), attrResponseModel.String(r.Model))
+			case *zai.EmbeddingsResponse:
+				span.SetAttributes(attrResponseModel.String(r.Model))
+			}
+			return result, err
+		}
+	}
+}
+
+// endCall records the outcome of a call that started at start and ends its span
+func endCall(span trace.Span, start time.Time, m zai.CallMetrics) {
+	if len(m.FinishReasons) > 0 {
+		span.SetAttributes(attrFinishReasons.StringSlice(m.FinishReasons))
+	}
+	if m.Usage != nil && m.Usage.TotalTokens > 0 {
+		span.SetAttributes(attrInputTokens.Int(m.Usage.PromptTokens), attrOutputTokens.Int(m.Usage.CompletionTokens))
+	}
+	if m.TimeToFirstChunk > 0 {
+		span.AddEvent("gen_ai.first_token", trace.WithTimestamp(start.Add(m.TimeToFirstChunk)))
+		span.SetAttributes(attrTimeToFirstToken.Float64(m.TimeToFirstChunk.Seconds()))
+	}
+	if m.StatusCode != 0 {
+		span.SetAttributes(attrHTTPStatusCode.Int(m.StatusCode))
+	}
+	var apiErr *zai.Error
+	if errors.As(m.Err, &apiErr) && apiErr.RequestID != "" {
+		span.SetAttributes(attrServerRequestID.String(apiErr.RequestID))
+	}
+	span.SetAttributes(attrRetryAttemptCount.Int(m.Attempts))
+	recordError(span, m.Err)
+	span.End()
+}
+
+// statusCode returns the HTTP status of the response an attempt ended with:
+// the status carried by err, 200 on success or 0 if there was no response
+func statusCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var apiErr *zai.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// recordError marks span as failed with the kind of err
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.SetAttributes(attrErrorType.String(zai.ErrorKind(err)))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,162 @@
+package otelzai_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	zai "github.com/yonwoo9/zai-go-sdk"
+	"github.com/yonwoo9/zai-go-sdk/otelzai"
+)
+
+// newTracedClient creates a client for baseURL that records its spans
+func newTracedClient(t *testing.T, baseURL string) (*zai.Client, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	middleware := otelzai.Middleware(
+		otelzai.WithTracerProvider(provider),
+		otelzai.WithPropagator(propagation.TraceContext{}),
+	)
+
+	client, err := zai.NewClient("test-key", &zai.ClientConfig{
+		BaseURL:           baseURL,
+		DisableTokenCache: true,
+		Middleware:        []zai.Middleware{middleware},
+		RetryPolicy:       &zai.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, recorder
+}
+
+func chatRequest() *zai.ChatCompletionRequest {
+	return &zai.ChatCompletionRequest{
+		Model:    "glm-4.7",
+		Messages: []zai.Message{zai.NewUserMessage("Hello")},
+	}
+}
+
+// attr returns the value of the attribute key of span
+func attr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddlewareRetriedCall(t *testing.T) {
+	var calls atomic.Int32
+	traceparents := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("Traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":"","message":"overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chat-1","model":"glm-4.7","choices":[{"finish_reason":"stop","message":{"role":"assistant","content":"Hi"}}],` +
+			`"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`))
+	}))
+	defer srv.Close()
+
+	client, recorder := newTracedClient(t, srv.URL)
+	if _, err := client.Chat.CreateChatCompletion(context.Background(), chatRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 2 attempts and the call", len(spans))
+	}
+	first, second, call := spans[0], spans[1], spans[2]
+
+	if call.Name() != "chat glm-4.7" {
+		t.Errorf("got call span %q, want %q", call.Name(), "chat glm-4.7")
+	}
+	for i, attempt := range []sdktrace.ReadOnlySpan{first, second} {
+		if attempt.Parent().SpanID() != call.SpanContext().SpanID() {
+			t.Errorf("attempt %d is not a child of the call span", i)
+		}
+		propagated := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(),
+			propagation.HeaderCarrier{"Traceparent": []string{<-traceparents}}))
+		if propagated.SpanID() != attempt.SpanContext().SpanID() {
+			t.Errorf("attempt %d sent trace context %v, want its own span", i, propagated.SpanID())
+		}
+	}
+
+	if first.Status().Code != codes.Error || attr(first, "http.response.status_code").AsInt64() != 503 {
+		t.Errorf("first attempt has status %v and code %v, want an error with 503", first.Status(), attr(first, "http.response.status_code"))
+	}
+	if attr(second, "http.request.resend_count").AsInt64() != 1 {
+		t.Errorf("second attempt has resend count %v, want 1", attr(second, "http.request.resend_count"))
+	}
+
+	if call.Status().Code == codes.Error {
+		t.Errorf("call span failed: %v", call.Status())
+	}
+	for key, want := range map[string]interface{}{
+		"gen_ai.response.id":         "chat-1",
+		"gen_ai.usage.input_tokens":  int64(3),
+		"gen_ai.usage.output_tokens": int64(2),
+		"zai.attempts":               int64(2),
+	} {
+		if got := attr(call, key).AsInterface(); got != want {
+			t.Errorf("call span has %s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestMiddlewareStreamError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {\"id\":\"1\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		io.WriteString(w, "data: {\"error\":{\"code\":\"1301\",\"message\":\"unsafe content\"}}\n\n")
+	}))
+	defer srv.Close()
+
+	client, recorder := newTracedClient(t, srv.URL)
+	stream, err := client.Chat.CreateChatCompletionStream(context.Background(), chatRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	if len(recorder.Ended()) != 1 {
+		t.Fatalf("got %d ended spans before reading the stream, want only the attempt", len(recorder.Ended()))
+	}
+	if _, err := stream.Accumulate(); err == nil {
+		t.Fatal("expected the in-stream error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the attempt and the call", len(spans))
+	}
+	call := spans[1]
+	if call.Status().Code != codes.Error {
+		t.Errorf("call span has status %v, want an error", call.Status())
+	}
+	if got := attr(call, "error.type").AsString(); got != "ContentFilterError" {
+		t.Errorf("call span has error type %q, want ContentFilterError", got)
+	}
+	if len(call.Events()) == 0 || call.Events()[0].Name != "gen_ai.first_token" {
+		t.Errorf("call span has events %v, want gen_ai.first_token first", call.Events())
+	}
+}
@@ -0,0 +1,321 @@
+package zai
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RateLimitDefaultModel is the RateLimiter entry that applies to models
+// without a budget of their own
+const RateLimitDefaultModel = "*"
+
+// RateLimit is the budget of a single model. Zero fields are unlimited.
+type RateLimit struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+}
+
+// RateLimiter paces requests on the client side so they stay within per-model
+// budgets instead of failing with 429. The tokens of a request are estimated
+// before it is sent and corrected with the usage the API reports. Callers
+// block until the budget allows the request or their context is done. A
+// limiter may be shared by several clients using the same account.
+type RateLimiter struct {
+	limits map[string]RateLimit
+
+	mu     sync.Mutex
+	models map[string]*modelBudget
+}
+
+// modelBudget holds the request and token buckets of a model
+type modelBudget struct {
+	requests tokenBucket
+	tokens   tokenBucket
+}
+
+// tokenBucket refills continuously at limit per minute up to limit. The
+// available amount may go negative when a request used more tokens than
+// estimated, which delays the following requests.
+type tokenBucket struct {
+	limit     float64
+	available float64
+	updated   time.Time
+}
+
+// rateLimited is implemented by requests the limiter applies to
+type rateLimited interface {
+	rateLimitModel() string
+	estimateTokens() int
+}
+
+// NewRateLimiter creates a limiter with the given budgets keyed by model
+// name. The RateLimitDefaultModel entry, if any, gives every other model a
+// budget of the same size.
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		limits: make(map[string]RateLimit, len(limits)),
+		models: make(map[string]*modelBudget),
+	}
+	for model, limit := range limits {
+		l.limits[model] = limit
+	}
+	return l
+}
+
+// Wait blocks until model may send a request using the given number of
+// tokens, then takes them from its budget
+func (l *RateLimiter) Wait(ctx context.Context, model string, tokens int) error {
+	for {
+		l.mu.Lock()
+		budget := l.budget(model)
+		if budget == nil {
+			l.mu.Unlock()
+			return nil
+		}
+		now := time.Now()
+		budget.requests.refill(now)
+		budget.tokens.refill(now)
+		wait := budget.requests.wait(1)
+		if d := budget.tokens.wait(float64(tokens)); d > wait {
+			wait = d
+		}
+		if wait <= 0 {
+			budget.requests.take(1)
+			budget.tokens.take(float64(tokens))
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// adjust adds delta tokens to the usage recorded for model. A negative delta
+// gives tokens back to the budget.
+func (l *RateLimiter) adjust(model string, delta int) {
+	if delta == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if budget := l.budget(model); budget != nil {
+		budget.tokens.refill(time.Now())
+		budget.tokens.take(float64(delta))
+	}
+}
+
+// budget returns the buckets of model, creating them on first use, or nil
+// when the model is not limited. l.mu must be held.
+func (l *RateLimiter) budget(model string) *modelBudget {
+	if budget, ok := l.models[model]; ok {
+		return budget
+	}
+
+	limit, ok := l.limits[model]
+	if !ok {
+		limit, ok = l.limits[RateLimitDefaultModel]
+	}
+	if !ok || (limit.RequestsPerMinute <= 0 && limit.TokensPerMinute <= 0) {
+		return nil
+	}
+
+	now := time.Now()
+	budget := &modelBudget{
+		requests: tokenBucket{limit: float64(limit.RequestsPerMinute), available: float64(limit.RequestsPerMinute), updated: now},
+		tokens:   tokenBucket{limit: float64(limit.TokensPerMinute), available: float64(limit.TokensPerMinute), updated: now},
+	}
+	l.models[model] = budget
+	return budget
+}
+
+// refill adds what accrued since the last update
+func (b *tokenBucket) refill(now time.Time) {
+	if b.limit <= 0 {
+		return
+	}
+	b.available += b.limit * float64(now.Sub(b.updated)) / float64(time.Minute)
+	if b.available > b.limit {
+		b.available = b.limit
+	}
+	b.updated = now
+}
+
+// wait returns how long until n can be taken. A request larger than the
+// whole budget only waits for a full bucket so it cannot block forever.
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.limit <= 0 {
+		return 0
+	}
+	if n > b.limit {
+		n = b.limit
+	}
+	if b.available >= n {
+		return 0
+	}
+	return time.Duration((n - b.available) / b.limit * float64(time.Minute))
+}
+
+// take removes n from the bucket
+func (b *tokenBucket) take(n float64) {
+	if b.limit > 0 {
+		b.available -= n
+	}
+}
+
+// rateReservation is the part of a model's budget taken by one API call
+type rateReservation struct {
+	limiter *RateLimiter
+	model   string
+	tokens  int
+
+	once sync.Once
+}
+
+// reserve waits for the budget a request needs. It returns nil when no
+// limiter is configured or the request is not rate limited.
+func (c *BaseClient) reserve(ctx context.Context, body interface{}) (*rateReservation, error) {
+	req, ok := body.(rateLimited)
+	if c.rateLimiter == nil || !ok {
+		return nil, nil
+	}
+
+	r := &rateReservation{
+		limiter: c.rateLimiter,
+		model:   req.rateLimitModel(),
+		tokens:  req.estimateTokens(),
+	}
+	if err := r.limiter.Wait(ctx, r.model, r.tokens); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// retry takes a request from the budget for another attempt of the call
+func (r *rateReservation) retry(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	return r.limiter.Wait(ctx, r.model, 0)
+}
+
+// settle replaces the estimated tokens with the usage the API reported. The
+// estimate is given back if the API rejected the request, and kept if the
+// outcome is unknown. Only the first call has an effect.
+func (r *rateReservation) settle(usage *CompletionUsage, err error) {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() {
+		switch {
+		case usage != nil && usage.TotalTokens > 0:
+			r.limiter.adjust(r.model, usage.TotalTokens-r.tokens)
+		case err != nil:
+			if apiErr := baseError(err); apiErr != nil && apiErr.StatusCode >= 400 {
+				r.limiter.adjust(r.model, -r.tokens)
+			}
+		}
+	})
+}
+
+// responseUsage returns the token usage reported in a decoded response
+func responseUsage(result interface{}) *CompletionUsage {
+	switch r := result.(type) {
+	case *ChatCompletion:
+		return &r.Usage
+	case *EmbeddingsResponse:
+		return &r.Usage
+	}
+	return nil
+}
+
+func (r *ChatCompletionRequest) rateLimitModel() string { return r.Model }
+
+// estimateTokens estimates the prompt from the text of the messages and tools
+// and adds the completion budget when MaxTokens is set
+func (r *ChatCompletionRequest) estimateTokens() int {
+	tokens := 0
+	for _, msg := range r.Messages {
+		tokens += 4 // Role and message framing
+		switch content := msg.Content.(type) {
+		case string:
+			tokens += estimateTextTokens(content)
+		case []ContentPart:
+			for _, part := range content {
+				tokens += estimateTextTokens(part.Text)
+				if part.ImageURL != nil {
+					tokens += estimatedImageTokens
+				}
+			}
+		}
+		for _, call := range msg.ToolCalls {
+			tokens += estimateTextTokens(call.Function.Name) + estimateTextTokens(call.Function.Arguments)
+		}
+	}
+	for _, tool := range r.Tools {
+		if tool.Function != nil {
+			params, _ := json.Marshal(tool.Function.Parameters)
+			tokens += estimateTextTokens(tool.Function.Name) + estimateTextTokens(tool.Function.Description) +
+				estimateTextTokens(string(params))
+		}
+	}
+	if r.MaxTokens != nil {
+		tokens += *r.MaxTokens
+	}
+	return tokens
+}
+
+func (r *EmbeddingsRequest) rateLimitModel() string { return r.Model }
+
+// estimateTokens estimates the tokens of the input texts, or counts them when
+// the input is already tokenized
+func (r *EmbeddingsRequest) estimateTokens() int {
+	switch input := r.Input.(type) {
+	case string:
+		return estimateTextTokens(input)
+	case []string:
+		tokens := 0
+		for _, text := range input {
+			tokens += estimateTextTokens(text)
+		}
+		return tokens
+	case []int:
+		return len(input)
+	case [][]int:
+		tokens := 0
+		for _, ids := range input {
+			tokens += len(ids)
+		}
+		return tokens
+	}
+	return 0
+}
+
+// estimatedImageTokens is charged for every image in a prompt
+const estimatedImageTokens = 1000
+
+// estimateTextTokens approximates the token count of text: about four ASCII
+// characters per token and one token for any other character, which errs on
+// the high side for CJK text
+func estimateTextTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
@@ -0,0 +1,50 @@
+package zai
+
+import (
+	"io"
+	"net/http"
+	"os"
+)
+
+// BinaryResponse represents a non-JSON response body such as generated audio
+// or downloaded file content. It must be closed after use.
+type BinaryResponse struct {
+	ContentType string
+	body        io.ReadCloser
+}
+
+func newBinaryResponse(resp *http.Response) *BinaryResponse {
+	return &BinaryResponse{
+		ContentType: resp.Header.Get("Content-Type"),
+		body:        resp.Body,
+	}
+}
+
+// Read reads from the response body
+func (r *BinaryResponse) Read(p []byte) (int, error) {
+	return r.body.Read(p)
+}
+
+// WriteTo copies the response body to w until EOF
+func (r *BinaryResponse) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, r.body)
+}
+
+// SaveToFile writes the response body to the named file, creating or truncating it
+func (r *BinaryResponse) SaveToFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Close closes the response body
+func (r *BinaryResponse) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,219 @@
+package zai
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRetryBaseDelay is the default delay before the first retry
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	// DefaultRetryMaxDelay is the default upper bound for a single retry delay
+	DefaultRetryMaxDelay = 30 * time.Second
+	// DefaultRetryMultiplier is the default growth factor between retry delays
+	DefaultRetryMultiplier = 2.0
+)
+
+// RetryPolicy controls the delay between retries of a failed request. The
+// number of retries is set by ClientConfig.MaxRetries. Zero fields take their
+// default values.
+type RetryPolicy struct {
+	// BaseDelay is the delay before the first retry
+	BaseDelay time.Duration
+	// MaxDelay caps a single delay, including one requested by Retry-After
+	MaxDelay time.Duration
+	// Multiplier is the factor the delay grows by after every attempt
+	Multiplier float64
+	// DisableJitter turns off full jitter, which picks each delay uniformly
+	// between zero and the computed backoff so clients don't retry in lockstep
+	DisableJitter bool
+	// IgnoreRetryAfter ignores the Retry-After header sent with 429 and 503 responses
+	IgnoreRetryAfter bool
+	// RetryableStatusCodes lists the HTTP statuses worth retrying. When nil,
+	// or when the error carries a known business code, IsRetryable decides.
+	RetryableStatusCodes []int
+	// OnRetry, if set, is called before every retry
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a retry that is about to happen
+type RetryAttempt struct {
+	Method  string
+	Path    string
+	Attempt int           // 1 for the first retry
+	Delay   time.Duration // Time to wait before retrying
+	Err     error         // Error of the failed attempt
+}
+
+// withDefaults returns a copy of p with zero fields set to their defaults
+func (p *RetryPolicy) withDefaults() RetryPolicy {
+	var policy RetryPolicy
+	if p != nil {
+		policy = *p
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = DefaultRetryBaseDelay
+	}
+	if policy.MaxDelay <= 0 {
+		policy.MaxDelay = DefaultRetryMaxDelay
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultRetryMultiplier
+	}
+	return policy
+}
+
+// delay returns how long to wait before the given retry (1-based) of a
+// request that failed with err
+func (p *RetryPolicy) delay(attempt int, err error) time.Duration {
+	if !p.IgnoreRetryAfter {
+		if apiErr := baseError(err); apiErr != nil && apiErr.RetryAfter > 0 {
+			return minDuration(apiErr.RetryAfter, p.MaxDelay)
+		}
+	}
+
+	backoff := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if backoff > float64(p.MaxDelay) {
+		backoff = float64(p.MaxDelay)
+	}
+
+	if p.DisableJitter {
+		return time.Duration(backoff)
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// shouldRetry reports whether a request that failed with err may be retried
+func (p *RetryPolicy) shouldRetry(err error) bool {
+	// Business codes take precedence over the status the error was sent with
+	apiErr := baseError(err)
+	if p.RetryableStatusCodes == nil || apiErr == nil || apiErr.StatusCode == 0 ||
+		businessCodes[apiErr.Code] != kindUnknown {
+		return IsRetryable(err)
+	}
+
+	for _, code := range p.RetryableStatusCodes {
+		if code == apiErr.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRetryable reports whether a request that failed with err is worth
+// retrying. Timeouts, transient connection failures, rate limiting, 408, 429
+// and 5xx responses are retryable. Billing, authentication and content errors
+// identified by their business code are not, even when sent with status 429.
+// Neither are client-side failures such as encoding the request or decoding
+// the response, other 4xx responses, DNS lookups of unknown hosts and TLS
+// certificate errors, since repeating the request cannot succeed or could
+// duplicate work the server already did.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var timeoutErr *APITimeoutError
+	if errors.As(err, &timeoutErr) {
+		return true
+	}
+	var connErr *APIConnectionError
+	if errors.As(err, &connErr) {
+		return isTransientConnError(connErr.Err.cause)
+	}
+
+	apiErr := baseError(err)
+	if apiErr == nil {
+		return false
+	}
+
+	switch businessCodes[apiErr.Code] {
+	case kindUnknown:
+		return apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode >= http.StatusInternalServerError
+	case kindRateLimit:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTransientConnError reports whether a transport error may go away on retry
+func isTransientConnError(err error) bool {
+	if err == nil {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return false
+	}
+
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		certInvalid      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		recordHeader     tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuthority) || errors.As(err, &certInvalid) ||
+		errors.As(err, &hostname) || errors.As(err, &recordHeader) {
+		return false
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Op == "parse" {
+		return false
+	}
+
+	return true
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date. It returns zero when the header is absent or invalid.
+func parseRetryAfter(header http.Header) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// baseError returns the *Error carried by err, or nil
+func baseError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return nil
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,359 @@
+package zai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetries is the MaxRetries of the clients created by newTestClient
+const testRetries = 2
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	next  http.RoundTripper
+	count atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+	return t.next.RoundTrip(req)
+}
+
+// roundTripFunc is an http.RoundTripper that fails every request with an error
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// newTestClient creates a client for baseURL that retries quickly. The
+// returned transport counts the attempts made.
+func newTestClient(t *testing.T, baseURL string, httpClient *http.Client) (*Client, *countingTransport) {
+	t.Helper()
+
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	next := httpClient.Transport
+	if next == nil {
+		next = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	transport := &countingTransport{next: next}
+	httpClient.Transport = transport
+
+	client, err := NewClient("test-key", &ClientConfig{
+		BaseURL:           baseURL,
+		HTTPClient:        httpClient,
+		MaxRetries:        testRetries,
+		DisableTokenCache: true,
+		RetryPolicy: &RetryPolicy{
+			BaseDelay:     time.Millisecond,
+			MaxDelay:      5 * time.Millisecond,
+			DisableJitter: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, transport
+}
+
+// waitForClient blocks until the client of r gives up. The body is read first
+// so the server notices when the connection is closed.
+func waitForClient(r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+	<-r.Context().Done()
+}
+
+func testChatRequest() *ChatCompletionRequest {
+	return &ChatCompletionRequest{
+		Model:    "glm-4.7",
+		Messages: []Message{NewUserMessage("Hello")},
+	}
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	tests := []struct {
+		status   int
+		attempts int32
+	}{
+		{http.StatusBadRequest, 1},
+		{http.StatusNotFound, 1},
+		{http.StatusRequestEntityTooLarge, 1},
+		{http.StatusTooManyRequests, testRetries + 1},
+		{http.StatusInternalServerError, testRetries + 1},
+		{http.StatusServiceUnavailable, testRetries + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"error":{"code":"","message":"failed"}}`))
+			}))
+			defer srv.Close()
+
+			client, transport := newTestClient(t, srv.URL, nil)
+			_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("got error %v, want status %d", err, tt.status)
+			}
+			if got := transport.count.Load(); got != tt.attempts {
+				t.Errorf("got %d attempts, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryRecovers(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":{"code":"","message":"overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chat-1","model":"glm-4.7","choices":[]}`))
+	}))
+	defer srv.Close()
+
+	client, transport := newTestClient(t, srv.URL, nil)
+	resp, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "chat-1" {
+		t.Errorf("got id %q, want chat-1", resp.ID)
+	}
+	if got := transport.count.Load(); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+}
+
+func TestRetryNegativeMaxRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chat-1","model":"glm-4.7","choices":[]}`))
+	}))
+	defer srv.Close()
+
+	client, transport := newTestClient(t, srv.URL, nil)
+	client.middleware = []Middleware{func(next APIHandler) APIHandler {
+		return func(ctx context.Context, call *APICall) (interface{}, error) {
+			call.MaxRetries = -1
+			return next(ctx, call)
+		}
+	}}
+
+	resp, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID != "chat-1" {
+		t.Errorf("got id %q, want chat-1", resp.ID)
+	}
+	if got := transport.count.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestRetryRejectedKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") == "Bearer revoked-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"1000","message":"invalid api key"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chat-1","model":"glm-4.7","choices":[]}`))
+	}))
+	defer srv.Close()
+
+	client, transport := newTestClient(t, srv.URL, nil)
+	client.credentials = NewKeyPool([]string{"revoked-key", "valid-key"})
+
+	var attempts []int
+	client.middleware = []Middleware{func(next APIHandler) APIHandler {
+		return func(ctx context.Context, call *APICall) (interface{}, error) {
+			call.OnAttempt(func(ctx context.Context, attempt int, header http.Header) (context.Context, func(error)) {
+				attempts = append(attempts, attempt)
+				return ctx, nil
+			})
+			return next(ctx, call)
+		}
+	}}
+
+	// Switching keys does not use up the retry budget
+	var meta ResponseMetadata
+	_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest(),
+		WithMaxRetries(0), WithResponseMetadata(&meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := transport.count.Load(); got != 2 {
+		t.Errorf("got %d requests, want 2", got)
+	}
+	if len(attempts) != 2 || attempts[0] != 0 || attempts[1] != 1 {
+		t.Errorf("got attempts %v, want [0 1]", attempts)
+	}
+	if meta.Attempts != 2 {
+		t.Errorf("got %d attempts in the metadata, want 2", meta.Attempts)
+	}
+}
+
+func TestRetryDecodeFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":`))
+	}))
+	defer srv.Close()
+
+	client, transport := newTestClient(t, srv.URL, nil)
+	_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+	if err == nil {
+		t.Fatal("expected a decode error")
+	}
+	if IsRetryable(err) {
+		t.Errorf("decode error %v is retryable", err)
+	}
+	if got := transport.count.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestRetryUnknownHost(t *testing.T) {
+	httpClient := &http.Client{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{
+				Err:        "no such host",
+				Name:       req.URL.Hostname(),
+				IsNotFound: true,
+			}}
+		}),
+	}
+
+	client, transport := newTestClient(t, "http://api.zai.invalid", httpClient)
+	_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+
+	var connErr *APIConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("got %T %v, want *APIConnectionError", err, err)
+	}
+	if IsRetryable(err) {
+		t.Errorf("unknown host error %v is retryable", err)
+	}
+	if got := transport.count.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestRetryCertificateError(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a server with an untrusted certificate")
+	}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	defer srv.Close()
+
+	// The default transport does not trust the test server's certificate
+	client, transport := newTestClient(t, srv.URL, nil)
+	_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+
+	var connErr *APIConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("got %T %v, want *APIConnectionError", err, err)
+	}
+	if IsRetryable(err) {
+		t.Errorf("certificate error %v is retryable", err)
+	}
+	if got := transport.count.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestRetryConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	baseURL := srv.URL
+	srv.Close()
+
+	client, transport := newTestClient(t, baseURL, nil)
+	_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+
+	var connErr *APIConnectionError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("got %T %v, want *APIConnectionError", err, err)
+	}
+	if got := transport.count.Load(); got != testRetries+1 {
+		t.Errorf("got %d attempts, want %d", got, testRetries+1)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waitForClient(r)
+	}))
+	defer srv.Close()
+
+	client, transport := newTestClient(t, srv.URL, &http.Client{Timeout: 20 * time.Millisecond})
+	_, err := client.Chat.CreateChatCompletion(context.Background(), testChatRequest())
+
+	var timeoutErr *APITimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("got %T %v, want *APITimeoutError", err, err)
+	}
+	if !IsRetryable(err) {
+		t.Errorf("timeout %v is not retryable", err)
+	}
+	if got := transport.count.Load(); got != testRetries+1 {
+		t.Errorf("got %d attempts, want %d", got, testRetries+1)
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		waitForClient(r)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	client, transport := newTestClient(t, srv.URL, nil)
+	_, err := client.Chat.CreateChatCompletion(ctx, testChatRequest())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if got := transport.count.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+}
+
+func TestIsRetryableBusinessCodes(t *testing.T) {
+	tests := []struct {
+		code      string
+		status    int
+		retryable bool
+	}{
+		{"", http.StatusTooManyRequests, true},
+		{"1113", http.StatusTooManyRequests, false},
+		{"1302", http.StatusTooManyRequests, true},
+		{"", http.StatusUnauthorized, false},
+		{"", http.StatusBadGateway, true},
+	}
+
+	for _, tt := range tests {
+		err := NewError(tt.status, "failed", "", tt.code)
+		if got := IsRetryable(err); got != tt.retryable {
+			t.Errorf("IsRetryable(%d %q) = %v, want %v", tt.status, tt.code, got, tt.retryable)
+		}
+	}
+}
@@ -0,0 +1,444 @@
+package zai
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	stringType        = reflect.TypeOf("")
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// GenerateSchema builds a JSON Schema object describing the Go struct v
+// (or a pointer to one) for use as FunctionDefinition.Parameters.
+//
+// Property names follow the `json` struct tags. The following tags are also
+// recognised on fields:
+//
+//	description:"..."  sets the property description
+//	enum:"a,b,c"       restricts the property, or the items of a slice, to the listed values
+//	required:"true"    marks the property as required
+//
+// Like encoding/json, time.Time is described as a date-time string, []byte as
+// a base64 string and fields with the `,string` option as strings. Types
+// implementing encoding.TextMarshaler are strings, and other json.Marshaler
+// types are left unconstrained.
+func GenerateSchema(v interface{}) (map[string]interface{}, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, &Error{Message: fmt.Sprintf("schema source must be a struct, got %v", reflect.TypeOf(v))}
+	}
+
+	return schemaFor(t, map[reflect.Type]bool{})
+}
+
+// NewFunctionToolFromStruct creates a function tool whose parameters are
+// generated from the Go struct params. See GenerateSchema for supported tags.
+func NewFunctionToolFromStruct(name, description string, params interface{}) (Tool, error) {
+	schema, err := GenerateSchema(params)
+	if err != nil {
+		return Tool{}, err
+	}
+	return NewFunctionTool(name, description, schema), nil
+}
+
+// NewTypedToolHandler adapts fn into a ToolHandler that decodes and validates
+// the call arguments into T first. Validation failures are returned as errors,
+// which RunTools reports back to the model.
+func NewTypedToolHandler[T any](fn func(ctx context.Context, args T) (string, error)) ToolHandler {
+	return func(ctx context.Context, arguments string) (string, error) {
+		var args T
+		if err := DecodeArguments(arguments, &args); err != nil {
+			return "", err
+		}
+		return fn(ctx, args)
+	}
+}
+
+// ArgumentsValidationError reports function call arguments that do not match
+// the struct they are decoded into
+type ArgumentsValidationError struct {
+	Problems []string
+}
+
+func (e *ArgumentsValidationError) Error() string {
+	return "invalid arguments: " + strings.Join(e.Problems, "; ")
+}
+
+// DecodeArguments unmarshals the JSON arguments of a function call into the
+// struct pointed to by v, checking the `required` and `enum` tags used by
+// GenerateSchema. Any mismatch is returned as an *ArgumentsValidationError.
+// Values of the types GenerateSchema leaves to their own JSON encoding are
+// checked by json.Unmarshal only.
+func DecodeArguments(arguments string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &Error{Message: "arguments target must be a non-nil pointer"}
+	}
+
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+
+	var problems []string
+	validateArguments(json.RawMessage(arguments), rv.Type().Elem(), "", &problems)
+	if len(problems) > 0 {
+		return &ArgumentsValidationError{Problems: problems}
+	}
+
+	if err := json.Unmarshal([]byte(arguments), v); err != nil {
+		return &ArgumentsValidationError{Problems: []string{err.Error()}}
+	}
+	return nil
+}
+
+// DecodeArguments unmarshals the arguments of the function call into v.
+// See the package-level DecodeArguments.
+func (f Function) DecodeArguments(v interface{}) error {
+	return DecodeArguments(f.Arguments, v)
+}
+
+// schemaField describes an exported struct field as seen by JSON
+type schemaField struct {
+	name     string
+	field    reflect.StructField
+	required bool
+	quoted   bool
+	enum     []string
+}
+
+// schemaFields returns the JSON-visible fields of struct type t, flattening
+// embedded structs the same way encoding/json does
+func schemaFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, schemaFields(ft)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		sf := schemaField{
+			name:     name,
+			field:    f,
+			required: f.Tag.Get("required") == "true",
+			quoted:   hasOption(opts, "string") && isScalar(f.Type),
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			sf.enum = strings.Split(enum, ",")
+		}
+		fields = append(fields, sf)
+	}
+	return fields
+}
+
+func schemaFor(t reflect.Type, visiting map[reflect.Type]bool) (map[string]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if schema, ok := marshalerSchema(t); ok {
+		return schema, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaFor(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, &Error{Message: fmt.Sprintf("unsupported map key type %v", t.Key())}
+		}
+		values, err := schemaFor(t.Elem(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case reflect.Struct:
+		if visiting[t] {
+			return nil, &Error{Message: fmt.Sprintf("recursive type %v is not supported", t)}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := map[string]interface{}{}
+		required := []string{}
+		for _, f := range schemaFields(t) {
+			prop := map[string]interface{}{"type": "string"}
+			if !f.quoted {
+				var err error
+				if prop, err = schemaFor(f.field.Type, visiting); err != nil {
+					return nil, err
+				}
+			}
+			if desc := f.field.Tag.Get("description"); desc != "" {
+				prop["description"] = desc
+			}
+			if f.enum != nil {
+				// The enum of a slice field restricts its items
+				target, itemType := prop, f.field.Type
+				for target["type"] == "array" {
+					target, _ = target["items"].(map[string]interface{})
+					itemType = derefType(itemType).Elem()
+				}
+				if target["type"] == "string" {
+					itemType = stringType
+				}
+				enum, err := enumValues(f.enum, itemType)
+				if err != nil {
+					return nil, err
+				}
+				target["enum"] = enum
+			}
+			properties[f.name] = prop
+			if f.required {
+				required = append(required, f.name)
+			}
+		}
+
+		schema := map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema, nil
+	default:
+		return nil, &Error{Message: fmt.Sprintf("unsupported type %v", t)}
+	}
+}
+
+// enumValues converts enum tag values to the JSON type of the field
+func enumValues(values []string, t reflect.Type) ([]interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	enum := make([]interface{}, len(values))
+	for i, v := range values {
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, &Error{Message: fmt.Sprintf("invalid integer enum value %q", v)}
+			}
+			enum[i] = n
+		case reflect.Float32, reflect.Float64:
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, &Error{Message: fmt.Sprintf("invalid number enum value %q", v)}
+			}
+			enum[i] = n
+		default:
+			enum[i] = v
+		}
+	}
+	return enum, nil
+}
+
+// validateArguments checks raw against the required and enum constraints of t,
+// appending a description of every violation to problems
+func validateArguments(raw json.RawMessage, t reflect.Type, path string, problems *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return
+	}
+	if _, ok := marshalerSchema(t); ok {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s must be an object", displayPath(path)))
+			return
+		}
+		for _, f := range schemaFields(t) {
+			fieldPath := f.name
+			if path != "" {
+				fieldPath = path + "." + f.name
+			}
+			value, ok := obj[f.name]
+			if !ok {
+				if f.required {
+					*problems = append(*problems, fmt.Sprintf("field %q is required", fieldPath))
+				}
+				continue
+			}
+			if f.enum != nil && !validateEnum(value, f.field.Type, f.enum, fieldPath, problems) {
+				continue
+			}
+			validateArguments(value, f.field.Type, fieldPath, problems)
+		}
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s must be an array", displayPath(path)))
+			return
+		}
+		for i, item := range items {
+			validateArguments(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	}
+}
+
+// validateEnum checks that raw, or every item of raw when t is a slice or
+// array, is one of the enum values. It reports whether raw is valid.
+func validateEnum(raw json.RawMessage, t reflect.Type, enum []string, path string, problems *[]string) bool {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return true
+	}
+	if !isList(t) {
+		if enumContains(enum, raw) {
+			return true
+		}
+		*problems = append(*problems, fmt.Sprintf("field %q must be one of [%s], got %s",
+			path, strings.Join(enum, ", "), raw))
+		return false
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		// Reported by validateArguments
+		return true
+	}
+	valid := true
+	for i, item := range items {
+		if !validateEnum(item, derefType(t).Elem(), enum, fmt.Sprintf("%s[%d]", path, i), problems) {
+			valid = false
+		}
+	}
+	return valid
+}
+
+// marshalerSchema returns the schema of the types encoding/json does not
+// encode by their structure: time.Time, []byte and types with their own JSON
+// or text encoding. ok is false for any other type.
+func marshalerSchema(t reflect.Type) (schema map[string]interface{}, ok bool) {
+	t = derefType(t)
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}, true
+	case implements(t, jsonMarshalerType):
+		return map[string]interface{}{}, true
+	case implements(t, textMarshalerType):
+		return map[string]interface{}{"type": "string"}, true
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 &&
+		!implements(t.Elem(), jsonMarshalerType) && !implements(t.Elem(), textMarshalerType):
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, true
+	}
+	return nil, false
+}
+
+// implements reports whether t or a pointer to t implements iface
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// isScalar reports whether t, or the type it points to, is a string, boolean
+// or number, the kinds the `,string` tag option applies to
+func isScalar(t reflect.Type) bool {
+	switch derefType(t).Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// hasOption reports whether the comma-separated tag options contain option
+func hasOption(opts, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isList reports whether t, or the type it points to, is a slice or array
+func isList(t reflect.Type) bool {
+	t = derefType(t)
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
+
+// derefType returns the type t points to, through any number of pointers
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// enumContains reports whether the JSON value raw is one of the enum values
+func enumContains(enum []string, raw json.RawMessage) bool {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return false
+	}
+	s := fmt.Sprint(value)
+	for _, e := range enum {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "arguments"
+	}
+	return fmt.Sprintf("field %q", path)
+}
@@ -1,11 +0,0 @@
-package zai
-
-// AudioService handles audio operations
-type AudioService struct {
-	client *BaseClient
-}
-
-// FilesService handles file operations
-type FilesService struct {
-	client *BaseClient
-}
@@ -0,0 +1,244 @@
+package zai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxSSELineSize caps the length of a single server-sent event line so a
+// misbehaving server cannot grow the read buffer without bound
+const maxSSELineSize = 1 << 20
+
+// sseEvent represents a single server-sent event
+type sseEvent struct {
+	ID    string // Last event ID seen on the stream
+	Event string // Event type, "message" when not set by the server
+	Data  []byte // Data lines joined with "\n"
+	Retry int    // Reconnection time in milliseconds, 0 when not set
+}
+
+// sseDecoder decodes server-sent events as described by the HTML Living
+// Standard. Lines may end in CRLF, LF or CR; comments and unknown fields are
+// ignored; multiple data fields are joined with newlines. A byte order mark
+// at the start of the stream is skipped.
+type sseDecoder struct {
+	scanner *bufio.Scanner
+	lastID  string
+	started bool // The first line has been read
+}
+
+func newSSEDecoder(r io.Reader) *sseDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSSELineSize)
+	scanner.Split(scanSSELines)
+	return &sseDecoder{scanner: scanner}
+}
+
+// Next returns the next event, or io.EOF when the stream ends. An event that
+// is still pending when the stream ends without a trailing blank line is
+// dispatched rather than discarded.
+func (d *sseDecoder) Next() (*sseEvent, error) {
+	var (
+		event   string
+		data    bytes.Buffer
+		hasData bool
+		retry   int
+	)
+
+	dispatch := func() *sseEvent {
+		if event == "" {
+			event = "message"
+		}
+		return &sseEvent{
+			ID:    d.lastID,
+			Event: event,
+			Data:  bytes.TrimSuffix(data.Bytes(), []byte("\n")),
+			Retry: retry,
+		}
+	}
+
+	for d.scanner.Scan() {
+		line := d.scanner.Bytes()
+		if !d.started {
+			line = bytes.TrimPrefix(line, []byte("\uFEFF"))
+			d.started = true
+		}
+
+		// A blank line ends the event
+		if len(line) == 0 {
+			if hasData {
+				return dispatch(), nil
+			}
+			event, retry = "", 0
+			continue
+		}
+
+		// Comment
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			value = bytes.TrimPrefix(value, []byte(" "))
+		}
+
+		switch string(field) {
+		case "event":
+			event = string(value)
+		case "data":
+			data.Write(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if bytes.IndexByte(value, 0) < 0 {
+				d.lastID = string(value)
+			}
+		case "retry":
+			if n, err := strconv.Atoi(string(value)); err == nil && n >= 0 {
+				retry = n
+			}
+		}
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return nil, &Error{Message: fmt.Sprintf("stream line exceeds %d bytes", maxSSELineSize)}
+		}
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	if hasData {
+		return dispatch(), nil
+	}
+	return nil, io.EOF
+}
+
+// scanSSELines is a bufio.SplitFunc that splits on CRLF, LF or a lone CR
+func scanSSELines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// A CR at the end of the buffer may be the first half of a CRLF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// streamReader reads JSON payloads from a streaming API response
+type streamReader struct {
+	decoder  *sseDecoder
+	response *http.Response
+	state    *callState // Finished when the stream ends or is closed
+}
+
+func newStreamReader(resp *http.Response) *streamReader {
+	return &streamReader{
+		decoder:  newSSEDecoder(resp.Body),
+		response: resp,
+	}
+}
+
+// next returns the data of the next event, or io.EOF when the stream ends.
+// Error events and error objects sent inside the stream are returned as
+// typed errors.
+func (s *streamReader) next() ([]byte, error) {
+	data, err := s.read()
+	if err == io.EOF {
+		s.state.finish(nil, nil)
+	} else if err != nil {
+		s.state.finish(nil, err)
+	}
+	return data, err
+}
+
+// read returns the data of the next event
+func (s *streamReader) read() ([]byte, error) {
+	for {
+		event, err := s.decoder.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		data := bytes.TrimSpace(event.Data)
+		if len(data) == 0 {
+			continue
+		}
+
+		// Check for stream end
+		if bytes.Equal(data, []byte("[DONE]")) {
+			return nil, io.EOF
+		}
+
+		if err := s.streamError(event.Event, data); err != nil {
+			if apiErr := baseError(err); apiErr != nil {
+				apiErr.RequestID = requestIDFromHeader(s.response.Header)
+			}
+			return nil, err
+		}
+
+		s.state.chunk(nil)
+		return data, nil
+	}
+}
+
+// streamError returns the error carried by an event, if any
+func (s *streamReader) streamError(event string, data []byte) error {
+	isErrorEvent := event == "error"
+	if !isErrorEvent && !bytes.Contains(data, []byte(`"error"`)) {
+		return nil
+	}
+
+	var errResp errorResponse
+	if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error != nil {
+		return errResp.Error.toError(s.response.StatusCode)
+	}
+	var errText struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &errText); err == nil && errText.Error != "" {
+		return (&errorBody{Message: errText.Error}).toError(s.response.StatusCode)
+	}
+
+	if isErrorEvent {
+		// Some servers send the error object without the envelope, or plain text
+		var body errorBody
+		if err := json.Unmarshal(data, &body); err == nil && body.Message != "" {
+			return body.toError(s.response.StatusCode)
+		}
+		return (&errorBody{Message: string(data)}).toError(s.response.StatusCode)
+	}
+
+	return nil
+}
+
+// close closes the underlying response body
+func (s *streamReader) close() error {
+	s.state.finish(nil, errStreamClosed)
+
+	if s.response != nil && s.response.Body != nil {
+		return s.response.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package zai
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// readEvents decodes every event of input, returning the error the decoder
+// stopped with
+func readEvents(r io.Reader) ([]*sseEvent, error) {
+	decoder := newSSEDecoder(r)
+	var events []*sseEvent
+	for {
+		event, err := decoder.Next()
+		if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+func TestSSEDecoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		data  []string
+	}{
+		{"LF", "data: a\n\ndata: b\n\n", []string{"a", "b"}},
+		{"CRLF", "data: a\r\n\r\ndata: b\r\n\r\n", []string{"a", "b"}},
+		{"CR", "data: a\r\rdata: b\r\r", []string{"a", "b"}},
+		{"mixed line endings", "data: a\r\n\ndata: b\r\rdata: c\n\r\n", []string{"a", "b", "c"}},
+		{"byte order mark", "\uFEFFdata: a\n\n", []string{"a"}},
+		{"byte order mark only at start", "data: a\n\n\uFEFFdata: b\n\n", []string{"a"}},
+		{"multiple data lines", "data: a\ndata: b\n\n", []string{"a\nb"}},
+		{"comments and unknown fields", ": ping\nfoo: bar\ndata: a\n\n", []string{"a"}},
+		{"no space after colon", "data:a\n\n", []string{"a"}},
+		{"blank lines without data", "\n\nevent: ping\n\ndata: a\n\n", []string{"a"}},
+		{"pending event at EOF", "data: a\n\ndata: b", []string{"a", "b"}},
+		{"pending event at EOF after newline", "data: a\n", []string{"a"}},
+		{"empty stream", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reading a byte at a time splits CRLF pairs across reads
+			for _, r := range []io.Reader{strings.NewReader(tt.input), iotest.OneByteReader(strings.NewReader(tt.input))} {
+				events, err := readEvents(r)
+				if err != io.EOF {
+					t.Fatalf("got error %v, want io.EOF", err)
+				}
+				var data []string
+				for _, e := range events {
+					data = append(data, string(e.Data))
+				}
+				if !reflect.DeepEqual(data, tt.data) {
+					t.Errorf("got data %q, want %q", data, tt.data)
+				}
+			}
+		})
+	}
+}
+
+func TestSSEDecoderFields(t *testing.T) {
+	events, err := readEvents(strings.NewReader("id: 1\nevent: delta\nretry: 500\ndata: a\n\ndata: b\n\n"))
+	if err != io.EOF {
+		t.Fatalf("got error %v, want io.EOF", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+
+	first, second := events[0], events[1]
+	if first.ID != "1" || first.Event != "delta" || first.Retry != 500 {
+		t.Errorf("got first event %+v, want id 1, event delta and retry 500", first)
+	}
+	// The last event ID carries over; the event type and retry do not
+	if second.ID != "1" || second.Event != "message" || second.Retry != 0 {
+		t.Errorf("got second event %+v, want id 1, event message and no retry", second)
+	}
+}
+
+func TestSSEDecoderLineTooLong(t *testing.T) {
+	input := "data: " + strings.Repeat("a", maxSSELineSize) + "\n\n"
+	_, err := readEvents(strings.NewReader(input))
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !strings.Contains(apiErr.Message, "exceeds") {
+		t.Fatalf("got error %v, want the line length error", err)
+	}
+}
+
+func TestStreamReaderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		check   func(error) bool
+		message string
+	}{
+		{
+			name:    "error object",
+			input:   `data: {"error":{"code":"1301","message":"unsafe content"}}`,
+			check:   func(err error) bool { var e *ContentFilterError; return errors.As(err, &e) },
+			message: "unsafe content",
+		},
+		{
+			name:    "error string",
+			input:   `data: {"error":"overloaded"}`,
+			check:   func(err error) bool { return baseError(err) != nil },
+			message: "overloaded",
+		},
+		{
+			name:    "error event with a bare error object",
+			input:   "event: error\ndata: {\"code\":\"1113\",\"message\":\"insufficient balance\"}",
+			check:   func(err error) bool { var e *InsufficientBalanceError; return errors.As(err, &e) },
+			message: "insufficient balance",
+		},
+		{
+			name:    "error event with plain text",
+			input:   "event: error\ndata: upstream failed",
+			check:   func(err error) bool { return baseError(err) != nil },
+			message: "upstream failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			header.Set("X-Request-Id", "req-1")
+			stream := newStreamReader(&http.Response{
+				StatusCode: http.StatusOK,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader("data: {\"id\":\"1\"}\n\n" + tt.input + "\n\n")),
+			})
+
+			if data, err := stream.next(); err != nil || string(data) != `{"id":"1"}` {
+				t.Fatalf("got %q and error %v before the error, want the first chunk", data, err)
+			}
+			_, err := stream.next()
+			if !tt.check(err) {
+				t.Fatalf("got %T %v, want a different error type", err, err)
+			}
+			if apiErr := baseError(err); apiErr.Message != tt.message || apiErr.RequestID != "req-1" {
+				t.Errorf("got message %q and request ID %q, want %q and req-1", apiErr.Message, apiErr.RequestID, tt.message)
+			}
+		})
+	}
+}
+
+func TestStreamReaderDone(t *testing.T) {
+	stream := newStreamReader(&http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader("data: {\"id\":\"1\"}\n\ndata: [DONE]\n\ndata: {\"id\":\"2\"}\n\n")),
+	})
+
+	if _, err := stream.next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.next(); err != io.EOF {
+		t.Errorf("got %v after [DONE], want io.EOF", err)
+	}
+}
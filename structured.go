@@ -0,0 +1,139 @@
+package zai
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Response format types
+const (
+	ResponseFormatTypeText       = "text"
+	ResponseFormatTypeJSONObject = "json_object"
+	ResponseFormatTypeJSONSchema = "json_schema"
+)
+
+// ResponseFormat represents the response_format of a chat completion request
+type ResponseFormat struct {
+	Type       string              `json:"type"`
+	JSONSchema *ResponseJSONSchema `json:"json_schema,omitempty"`
+}
+
+// ResponseJSONSchema represents the schema the model output must conform to
+type ResponseJSONSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema"`
+	Strict      *bool                  `json:"strict,omitempty"`
+}
+
+// Helper function to create a plain text response format
+func NewTextResponseFormat() *ResponseFormat {
+	return &ResponseFormat{Type: ResponseFormatTypeText}
+}
+
+// Helper function to create a JSON object response format
+func NewJSONObjectResponseFormat() *ResponseFormat {
+	return &ResponseFormat{Type: ResponseFormatTypeJSONObject}
+}
+
+// Helper function to create a JSON schema response format
+func NewJSONSchemaResponseFormat(name string, schema map[string]interface{}) *ResponseFormat {
+	return &ResponseFormat{
+		Type: ResponseFormatTypeJSONSchema,
+		JSONSchema: &ResponseJSONSchema{
+			Name:   name,
+			Schema: schema,
+		},
+	}
+}
+
+// CreateStructuredCompletion creates a chat completion whose output is decoded
+// into a value of the struct type T.
+//
+// Unless req.ResponseFormat is already set, a json_schema response format
+// generated from T is sent with the request. Code fences around the returned
+// JSON are stripped before decoding, and the `required` and `enum` tags are
+// validated as in DecodeArguments. When decoding fails, the model is shown the
+// error and asked again up to maxRepairs times. The last completion is
+// returned alongside the value, and alongside the error when all attempts fail.
+// opts apply to every completion requested.
+func CreateStructuredCompletion[T any](ctx context.Context, s *ChatService, req *ChatCompletionRequest, maxRepairs int, opts ...CallOption) (*T, *ChatCompletion, error) {
+	turn := *req
+	turn.Messages = append([]Message(nil), req.Messages...)
+
+	if turn.ResponseFormat == nil {
+		var zero T
+		schema, err := GenerateSchema(zero)
+		if err != nil {
+			return nil, nil, err
+		}
+		turn.ResponseFormat = NewJSONSchemaResponseFormat(schemaName(reflect.TypeOf(zero)), schema)
+	}
+
+	for attempt := 0; ; attempt++ {
+		completion, err := s.CreateChatCompletion(ctx, &turn, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(completion.Choices) == 0 {
+			return nil, completion, &Error{Message: "completion has no choices"}
+		}
+
+		message := completion.Choices[0].Message
+		content := ""
+		if message.Content != nil {
+			content = *message.Content
+		}
+
+		var value T
+		err = DecodeArguments(stripCodeFences(content), &value)
+		if err == nil {
+			return &value, completion, nil
+		}
+		if attempt >= maxRepairs {
+			return nil, completion, err
+		}
+
+		turn.Messages = append(turn.Messages,
+			message.ToMessage(),
+			NewUserMessage(fmt.Sprintf("Your previous response could not be used: %v. "+
+				"Respond again with only a JSON value that matches the requested schema.", err)),
+		)
+	}
+}
+
+// stripCodeFences removes a surrounding Markdown code fence, such as
+// ```json ... ```, from s. The fence may be on a single line.
+func stripCodeFences(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+
+	// A language tag is a word directly after the opening fence, followed by
+	// a space or newline; a lone word such as true is the content itself
+	tag := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("_+-.", r)
+	})
+	if tag > 0 && unicode.IsSpace(rune(s[tag])) {
+		s = s[tag:]
+	}
+	return strings.TrimSpace(s)
+}
+
+// schemaName derives a response schema name from a Go type
+func schemaName(t reflect.Type) string {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Name() == "" {
+		return "response"
+	}
+	return t.Name()
+}
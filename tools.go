@@ -0,0 +1,135 @@
+package zai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxToolIterations is the default maximum number of model round trips in RunTools
+const DefaultMaxToolIterations = 10
+
+// ToolHandler executes a function tool call. It receives the raw JSON
+// arguments produced by the model and returns the content sent back as the
+// tool result.
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+// ToolRegistry maps function names to the handlers that execute them
+type ToolRegistry map[string]ToolHandler
+
+// RunToolsResult represents the outcome of an automatic tool-execution loop
+type RunToolsResult struct {
+	Completion *ChatCompletion // The final completion that ended the loop
+	Messages   []Message       // The full transcript, including tool calls and results
+	Usage      CompletionUsage // Token usage summed over every completion in the loop
+	Iterations int             // Number of completions requested
+}
+
+// RunTools creates chat completions in a loop, executing every function tool
+// call the model makes with the matching handler and sending the results back
+// until the model stops calling tools. Tool calls made in the same turn are
+// executed in parallel. Handler errors and calls to unknown functions are
+// reported to the model as the tool result so it can recover.
+//
+// maxIterations bounds the number of completions; zero means
+// DefaultMaxToolIterations. If the bound is reached while the model is still
+// calling tools, those calls are not executed and the result so far is
+// returned together with an error. The result so far is also returned when a
+// completion fails. opts apply to every completion requested.
+func (s *ChatService) RunTools(ctx context.Context, req *ChatCompletionRequest, tools ToolRegistry, maxIterations int, opts ...CallOption) (*RunToolsResult, error) {
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxToolIterations
+	}
+
+	turn := *req
+	result := &RunToolsResult{
+		Messages: append([]Message(nil), req.Messages...),
+	}
+
+	for {
+		turn.Messages = result.Messages
+		completion, err := s.CreateChatCompletion(ctx, &turn, opts...)
+		if err != nil {
+			return result, err
+		}
+
+		result.Iterations++
+		result.Completion = completion
+		result.Usage.add(completion.Usage)
+
+		if len(completion.Choices) == 0 {
+			return result, nil
+		}
+
+		choice := completion.Choices[0]
+		result.Messages = append(result.Messages, choice.Message.ToMessage())
+		if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) == 0 {
+			return result, nil
+		}
+
+		// The results could not be sent back, so the tools are not run
+		if result.Iterations >= maxIterations {
+			return result, &Error{Message: fmt.Sprintf("tool loop did not finish within %d iterations", maxIterations)}
+		}
+
+		result.Messages = append(result.Messages, tools.execute(ctx, choice.Message.ToolCalls)...)
+	}
+}
+
+// execute runs the given tool calls in parallel and returns their result
+// messages in call order
+func (r ToolRegistry) execute(ctx context.Context, calls []ToolCall) []Message {
+	messages := make([]Message, len(calls))
+
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func(i int, call ToolCall) {
+			defer wg.Done()
+			messages[i] = NewToolResultMessage(call.ID, r.call(ctx, call))
+		}(i, call)
+	}
+	wg.Wait()
+
+	return messages
+}
+
+// call runs a single tool call and returns its result content
+func (r ToolRegistry) call(ctx context.Context, call ToolCall) (content string) {
+	handler, ok := r[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown function %q", call.Function.Name)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			content = fmt.Sprintf("error: function %q panicked: %v", call.Function.Name, p)
+		}
+	}()
+
+	output, err := handler(ctx, call.Function.Arguments)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	return output
+}
+
+// add accumulates the token counts of other into u
+func (u *CompletionUsage) add(other CompletionUsage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+
+	if other.PromptTokensDetails != nil {
+		if u.PromptTokensDetails == nil {
+			u.PromptTokensDetails = &PromptTokensDetails{}
+		}
+		u.PromptTokensDetails.CachedTokens += other.PromptTokensDetails.CachedTokens
+	}
+	if other.CompletionTokensDetails != nil {
+		if u.CompletionTokensDetails == nil {
+			u.CompletionTokensDetails = &CompletionTokensDetails{}
+		}
+		u.CompletionTokensDetails.ReasoningTokens += other.CompletionTokensDetails.ReasoningTokens
+	}
+}
@@ -47,13 +47,13 @@ type VideoGenerationRequest struct {
 }
 
 // Generations generates videos from text prompts or images
-func (s *VideosService) Generations(ctx context.Context, req *VideoGenerationRequest) (*VideoObject, error) {
+func (s *VideosService) Generations(ctx context.Context, req *VideoGenerationRequest, opts ...CallOption) (*VideoObject, error) {
 	if req.Model == "" {
 		return nil, &Error{Message: "model must be provided"}
 	}
 
 	var result VideoObject
-	err := s.client.doRequest(ctx, http.MethodPost, "/videos/generations", req, &result)
+	err := s.client.doRequest(ctx, http.MethodPost, "/videos/generations", req, &result, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -62,13 +62,13 @@ func (s *VideosService) Generations(ctx context.Context, req *VideoGenerationReq
 }
 
 // RetrieveVideosResult retrieves the result of a video generation operation
-func (s *VideosService) RetrieveVideosResult(ctx context.Context, id string) (*VideoObject, error) {
+func (s *VideosService) RetrieveVideosResult(ctx context.Context, id string, opts ...CallOption) (*VideoObject, error) {
 	if id == "" {
 		return nil, &Error{Message: "id must be provided"}
 	}
 
 	var result VideoObject
-	err := s.client.doRequest(ctx, http.MethodGet, fmt.Sprintf("/async-result/%s", id), nil, &result)
+	err := s.client.doRequest(ctx, http.MethodGet, fmt.Sprintf("/async-result/%s", id), nil, &result, opts...)
 	if err != nil {
 		return nil, err
 	}